@@ -43,6 +43,12 @@ func initFlags() {
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "sign-url" {
+		signURL(os.Args[2:])
+		return
+	}
+
 	initFlags()
 
 	log.SetOutput(os.Stdout)
@@ -66,7 +72,7 @@ func main() {
 	config := models.InitConfig(configFile, DefaultConfigPath)
 
 	// Check route count
-	if len(config.RouteFiles) == 0 {
+	if len(config.RouteFiles) == 0 && !config.HasStreamTasks() {
 		log.Error("No route found!")
 		return
 	}
@@ -78,7 +84,7 @@ func main() {
 		return
 	}
 
-	if len(routes) == 0 {
+	if len(routes) == 0 && !config.HasStreamTasks() {
 		log.Fatal("No route was found")
 	}
 
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Print a signed URL for a location requiring signed URLs
+func signURL(args []string) {
+	flags := flag.NewFlagSet("sign-url", flag.ExitOnError)
+	configPath := flags.String("config", "", "Specify the configfile")
+	ttl := flags.Duration("ttl", 0, "Lifetime of the URL. Uses the DefaultTTL of the location if not set")
+	ip := flags.String("ip", "", "IP of the client if the signature is bound to it")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s sign-url [options] <url>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	configFile := DefaultConfigFile
+	if path := getEnvar("PROXY_CONFIG", *configPath); len(path) > 0 {
+		configFile = path
+	}
+
+	config := models.InitConfig(configFile, DefaultConfigPath)
+	routes, err := config.LoadRoutes()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, flags.Arg(0), nil)
+	if err != nil || len(req.URL.Host) == 0 {
+		log.Fatalf("Invalid URL '%s'", flags.Arg(0))
+	}
+
+	var routePointers []*models.Route
+	for i := range routes {
+		routePointers = append(routePointers, &routes[i])
+	}
+
+	location := models.FindMatchingLocation(routePointers, req)
+	if location == nil || location.SignedURL == nil {
+		log.Fatalf("No location requiring signed URLs found for '%s'", flags.Arg(0))
+	}
+
+	if location.SignedURL.BindIP && len(*ip) == 0 {
+		log.Fatal("The signature of this location is bound to the client IP. Use -ip")
+	}
+
+	if *ttl <= 0 {
+		*ttl = location.SignedURL.GetDefaultTTL()
+	}
+
+	location.SignedURL.Sign(req.URL, time.Now().Add(*ttl), *ip)
+	fmt.Println(req.URL.String())
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// LocationAction action to do for requests matching a location
+type LocationAction string
+
+// ...
+const (
+	ProxyAction    LocationAction = "proxy"
+	RedirectAction LocationAction = "redirect"
+	RespondAction  LocationAction = "respond"
+)
+
+// LocationRedirect redirects requests of a location
+type LocationRedirect struct {
+	// Target URL. Variables like $host or $path can be used
+	Target string
+	// HTTP status code (301, 302, 303, 307, 308)
+	Code int
+	// Append the path following the location to the target
+	PreservePath bool
+	// Append the query of the request to the target
+	PreserveQuery bool
+}
+
+// LocationResponse a fixed response for requests of a location
+type LocationResponse struct {
+	Code    int
+	Headers map[string]string `toml:",omitempty"`
+	Body    string            `toml:",omitempty"`
+}
+
+// GetAction returns the action of a location. If not set, return default action
+func (location *RouteLocation) GetAction() LocationAction {
+	if len(location.Action) == 0 {
+		return ProxyAction
+	}
+	return location.Action
+}
+
+// GetCode returns the status code. If not set, return default code
+func (redirect LocationRedirect) GetCode() int {
+	if redirect.Code == 0 {
+		return http.StatusMovedPermanently
+	}
+	return redirect.Code
+}
+
+// GetCode returns the status code. If not set, return default code
+func (response LocationResponse) GetCode() int {
+	if response.Code == 0 {
+		return http.StatusOK
+	}
+	return response.Code
+}
+
+// BuildTarget appends path and query of the request to the target if configured
+func (redirect LocationRedirect) BuildTarget(target, relativePath, rawQuery string) string {
+	preservePath := redirect.PreservePath && relativePath != "/"
+	preserveQuery := redirect.PreserveQuery && len(rawQuery) > 0
+	if !preservePath && !preserveQuery {
+		return target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+
+	// The path goes in front of the query and fragment of the target
+	if preservePath {
+		if len(u.RawPath) > 0 {
+			u.RawPath = singleJoiningSlash(u.RawPath, (&url.URL{Path: relativePath}).EscapedPath())
+		}
+		u.Path = singleJoiningSlash(u.Path, relativePath)
+	}
+
+	if preserveQuery {
+		if len(u.RawQuery) > 0 {
+			u.RawQuery += "&" + rawQuery
+		} else {
+			u.RawQuery = rawQuery
+		}
+	}
+
+	return u.String()
+}
+
+// Check the action config of a location. Returns an error message on failure
+func (location *RouteLocation) checkAction() string {
+	switch location.GetAction() {
+	case ProxyAction:
+	case RedirectAction:
+		if location.Redirect == nil || len(location.Redirect.Target) == 0 {
+			return "Missing redirect target"
+		}
+
+		switch location.Redirect.GetCode() {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return "Invalid redirect code"
+		}
+	case RespondAction:
+		if location.Respond == nil {
+			return "Missing response"
+		}
+
+		if code := location.Respond.GetCode(); code < 100 || code > 599 {
+			return "Invalid response code"
+		}
+	default:
+		return "Unknown action '" + string(location.Action) + "'"
+	}
+
+	return ""
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JojiiOfficial/gaw"
+)
+
+// JWTAlgorithms supported algorithms to sign JSON web tokens
+var JWTAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// AuthSatisfy defines how authentication is combined with the IP allow list
+type AuthSatisfy string
+
+// ...
+const (
+	// SatisfyAll requires an allowed IP and a valid login
+	SatisfyAll AuthSatisfy = "all"
+	// SatisfyAny requires an IP of the allow list or a valid login
+	SatisfyAny AuthSatisfy = "any"
+)
+
+// LocationAuth authentication for a location
+type LocationAuth struct {
+	// How to combine the authentication with the Allow list (all, any)
+	Satisfy AuthSatisfy `toml:",omitempty"`
+	// Header to pass the authenticated username to the upstream
+	UserHeader string `toml:",omitempty"`
+
+	Basic   *BasicAuth
+	Forward *ForwardAuth
+	JWT     *JWTAuth
+	OIDC    *OIDCAuth
+}
+
+// BasicAuth HTTP basic authentication using a htpasswd file
+type BasicAuth struct {
+	// htpasswd file with bcrypt, SHA or apr1 hashes
+	HtpasswdFile string
+	Realm        string `toml:",omitempty"`
+}
+
+// ForwardAuth asks an external service whether a request is allowed
+type ForwardAuth struct {
+	// URL of the auth service
+	Address string
+	// Headers of the client request passed to the auth service
+	RequestHeaders []string `toml:",omitempty"`
+	// Headers of a successful auth response copied to the upstream request
+	ResponseHeaders []string `toml:",omitempty"`
+	// Header of a successful auth response containing the username
+	UserResponseHeader string `toml:",omitempty"`
+	// Time to cache successful results. Zero disables caching
+	CacheTTL ConfigDuration
+	// Timeout of the auth request
+	Timeout ConfigDuration
+}
+
+// JWTAuth validates JSON web tokens sent as bearer token or cookie
+type JWTAuth struct {
+	// Read the token from this cookie if there is no Authorization header
+	Cookie string `toml:",omitempty"`
+	// PEM files containing public keys or certificates
+	KeyFiles []string `toml:",omitempty"`
+	// JWKS document to get the keys from. Can be a file or an URL
+	JWKS string `toml:",omitempty"`
+	// Time to cache a JWKS document loaded from an URL
+	JWKSCacheTTL ConfigDuration
+	// Allowed signing algorithms
+	Algorithms []string `toml:",omitempty"`
+	// Required issuer
+	Issuer string `toml:",omitempty"`
+	// The token has to be issued for one of these audiences
+	Audiences []string `toml:",omitempty"`
+	// Claims which have to be present. A non empty value has to match
+	RequiredClaims map[string]string `toml:",omitempty"`
+	// Upstream request headers set to the value of a claim
+	ClaimHeaders map[string]string `toml:",omitempty"`
+	// Claim containing the username
+	UserClaim string `toml:",omitempty"`
+	// Allowed clock skew when checking exp and nbf
+	Leeway ConfigDuration
+	// Accept tokens without exp claim, they never expire
+	AllowMissingExp bool
+	Realm           string `toml:",omitempty"`
+}
+
+// GetSatisfy returns the satisfy mode. If not set, return SatisfyAll
+func (auth LocationAuth) GetSatisfy() AuthSatisfy {
+	if len(auth.Satisfy) == 0 {
+		return SatisfyAll
+	}
+	return AuthSatisfy(strings.ToLower(string(auth.Satisfy)))
+}
+
+// GetRealm returns the realm. If not set, return default realm
+func (basic BasicAuth) GetRealm() string {
+	if len(basic.Realm) == 0 {
+		return "Restricted"
+	}
+	return basic.Realm
+}
+
+// GetRequestHeaders returns the headers to pass. If not set, return default headers
+func (forward ForwardAuth) GetRequestHeaders() []string {
+	if len(forward.RequestHeaders) == 0 {
+		return []string{"Authorization", "Cookie"}
+	}
+	return forward.RequestHeaders
+}
+
+// GetTimeout returns the timeout. If not set, return default timeout
+func (forward ForwardAuth) GetTimeout() time.Duration {
+	if forward.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(forward.Timeout)
+}
+
+// GetJWKSCacheTTL returns the time to cache a JWKS. If not set, return default duration
+func (jwt JWTAuth) GetJWKSCacheTTL() time.Duration {
+	if jwt.JWKSCacheTTL <= 0 {
+		return time.Hour
+	}
+	return time.Duration(jwt.JWKSCacheTTL)
+}
+
+// GetUserClaim returns the claim containing the username. If not set, return 'sub'
+func (jwt JWTAuth) GetUserClaim() string {
+	if len(jwt.UserClaim) == 0 {
+		return "sub"
+	}
+	return jwt.UserClaim
+}
+
+// Check returns an error message if the auth config is invalid
+func (auth LocationAuth) Check() string {
+	if satisfy := auth.GetSatisfy(); satisfy != SatisfyAll && satisfy != SatisfyAny {
+		return "Invalid auth Satisfy '" + string(auth.Satisfy) + "'"
+	}
+
+	if auth.Basic != nil {
+		if _, err := os.Stat(auth.Basic.HtpasswdFile); err != nil {
+			return "Htpasswd file '" + auth.Basic.HtpasswdFile + "' not found"
+		}
+	}
+
+	if auth.Forward != nil {
+		u, err := url.Parse(auth.Forward.Address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return "Invalid forward auth address '" + auth.Forward.Address + "'"
+		}
+	}
+
+	if auth.JWT != nil {
+		if len(auth.JWT.KeyFiles) == 0 && len(auth.JWT.JWKS) == 0 {
+			return "Missing KeyFiles or JWKS for JWT auth"
+		}
+		for _, file := range auth.JWT.KeyFiles {
+			if _, err := os.Stat(file); err != nil {
+				return "JWT key file '" + file + "' not found"
+			}
+		}
+		for _, alg := range auth.JWT.Algorithms {
+			if !gaw.IsInStringArray(alg, JWTAlgorithms) {
+				return "Unsupported JWT algorithm '" + alg + "'"
+			}
+		}
+	}
+
+	return ""
+}
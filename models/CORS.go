@@ -0,0 +1,116 @@
+package models
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// CORSConfig cross-origin resource sharing policy of a location
+type CORSConfig struct {
+	// Allowed origins. Can be '*', an exact origin, a wildcard like
+	// 'https://*.example.com' or a regex in curly braces
+	AllowOrigins []string
+	// Allowed methods of preflight requests
+	AllowMethods []string `toml:",omitempty"`
+	// Allowed request headers. '*' allows all requested headers
+	AllowHeaders []string `toml:",omitempty"`
+	// Response headers readable by the client
+	ExposeHeaders []string `toml:",omitempty"`
+	// Allow cookies and authorization headers
+	AllowCredentials bool
+	// Seconds a preflight response can be cached by the client
+	MaxAge int
+	// Replace CORS headers sent by the upstream
+	OverrideUpstream bool
+}
+
+// GetAllowMethods returns the allowed methods. If not set, return default methods
+func (cors CORSConfig) GetAllowMethods() []string {
+	if len(cors.AllowMethods) == 0 {
+		return []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	return cors.AllowMethods
+}
+
+// AllowsOrigin returns true if origin is allowed
+func (cors CORSConfig) AllowsOrigin(origin string) bool {
+	if len(origin) == 0 {
+		return false
+	}
+
+	for _, allowed := range cors.AllowOrigins {
+		switch {
+		case allowed == "*":
+			return true
+		case isRegexString(allowed):
+			if r := originRegex(allowed); r != nil && r.MatchString(origin) {
+				return true
+			}
+		case strings.Contains(allowed, "*"):
+			prefix := allowed[:strings.Index(allowed, "*")]
+			suffix := allowed[strings.Index(allowed, "*")+1:]
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		case strings.EqualFold(allowed, origin):
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compile an origin regex in curly braces. It has to match the whole origin
+func originRegex(allowed string) *regexp.Regexp {
+	return RegexpStore.GetPattern("^(?:" + allowed[1:len(allowed)-1] + ")$")
+}
+
+// AllowsAnyOrigin returns true if every origin is allowed
+func (cors CORSConfig) AllowsAnyOrigin() bool {
+	for _, allowed := range cors.AllowOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsMethod returns true if method is allowed
+func (cors CORSConfig) AllowsMethod(method string) bool {
+	for _, allowed := range cors.GetAllowMethods() {
+		if allowed == "*" || strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHeader returns true if the request header name is allowed
+func (cors CORSConfig) AllowsHeader(name string) bool {
+	for _, allowed := range cors.AllowHeaders {
+		if allowed == "*" || strings.EqualFold(allowed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error message if the config is invalid
+func (cors CORSConfig) Check() string {
+	if len(cors.AllowOrigins) == 0 {
+		return "Missing AllowOrigins in CORS config"
+	}
+
+	for _, allowed := range cors.AllowOrigins {
+		if isRegexString(allowed) {
+			if originRegex(allowed) == nil {
+				return "Invalid CORS origin regex '" + allowed + "'"
+			}
+		} else if strings.Count(allowed, "*") > 1 {
+			return "Only one wildcard is allowed in CORS origin '" + allowed + "'"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/JojiiOfficial/ReverseProxy/models/units"
+)
+
+// CacheConfig config for the response cache of a location
+type CacheConfig struct {
+	// Max size of all responses kept in memory
+	MaxSize units.Datasize
+	// Responses bigger than MaxEntrySize won't be cached
+	MaxEntrySize units.Datasize
+	// Directory to persist cached responses in. Optional
+	Directory string `toml:",omitempty"`
+	// Max size of all responses stored in Directory
+	MaxDiskSize units.Datasize
+}
+
+// GetMaxSize returns the max memory size in bytes. If not set, return default size
+func (cache CacheConfig) GetMaxSize() int64 {
+	if cache.MaxSize <= 0 {
+		return int64((units.Megabyte * 64).Bytes())
+	}
+	return int64(cache.MaxSize.Bytes())
+}
+
+// GetMaxEntrySize returns the max size of a single response in bytes. If not set, return default size
+func (cache CacheConfig) GetMaxEntrySize() int64 {
+	if cache.MaxEntrySize <= 0 {
+		return int64((units.Megabyte * 8).Bytes())
+	}
+	return int64(cache.MaxEntrySize.Bytes())
+}
+
+// GetMaxDiskSize returns the max disk size in bytes. If not set, return default size
+func (cache CacheConfig) GetMaxDiskSize() int64 {
+	if cache.MaxDiskSize <= 0 {
+		return int64((units.Gigabyte * 1).Bytes())
+	}
+	return int64(cache.MaxDiskSize.Bytes())
+}
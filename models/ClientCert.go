@@ -0,0 +1,129 @@
+package models
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// ClientCertVerify defines if a client certificate is required
+type ClientCertVerify string
+
+// ...
+const (
+	ClientCertRequire  ClientCertVerify = "require"
+	ClientCertOptional ClientCertVerify = "optional"
+)
+
+// ClientCertConfig client certificate (mTLS) authentication
+type ClientCertConfig struct {
+	// PEM bundle of the CAs allowed to issue client certificates
+	CAFile string
+	// require or optional
+	Verify ClientCertVerify `toml:",omitempty"`
+	// Patterns the subject has to match. Matches the common name or the full DN
+	AllowedSubjects []string `toml:",omitempty"`
+	// Patterns one of the DNS, email, URI or IP SANs has to match
+	AllowedSANs []string `toml:",omitempty"`
+	// Prefix of the headers used to pass the identity to the upstream
+	HeaderPrefix string `toml:",omitempty"`
+	// Pass the PEM encoded certificate to the upstream
+	ForwardPEM bool
+}
+
+// GetVerify returns the verification mode. If not set, return ClientCertRequire
+func (clientCert ClientCertConfig) GetVerify() ClientCertVerify {
+	if len(clientCert.Verify) == 0 {
+		return ClientCertRequire
+	}
+	return ClientCertVerify(strings.ToLower(string(clientCert.Verify)))
+}
+
+// GetHeaderPrefix returns the header prefix. If not set, return default prefix
+func (clientCert ClientCertConfig) GetHeaderPrefix() string {
+	if len(clientCert.HeaderPrefix) == 0 {
+		return "X-Client-Cert"
+	}
+	return clientCert.HeaderPrefix
+}
+
+// LoadCAs loads the CA bundle
+func (clientCert ClientCertConfig) LoadCAs() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	return pool, clientCert.AppendCAs(pool)
+}
+
+// AppendCAs adds the CAs of the bundle to pool
+func (clientCert ClientCertConfig) AppendCAs(pool *x509.CertPool) error {
+	data, err := ioutil.ReadFile(clientCert.CAFile)
+	if err != nil {
+		return err
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return errors.New("no certificate found in " + clientCert.CAFile)
+	}
+	return nil
+}
+
+// MatchIdentity returns true if the certificate matches the allowed subjects and SANs
+func (clientCert ClientCertConfig) MatchIdentity(cert *x509.Certificate) bool {
+	if len(clientCert.AllowedSubjects) > 0 {
+		if !matchAnyPattern(clientCert.AllowedSubjects, cert.Subject.CommonName, cert.Subject.String()) {
+			return false
+		}
+	}
+
+	if len(clientCert.AllowedSANs) > 0 && !matchAnyPattern(clientCert.AllowedSANs, CertificateSANs(cert)...) {
+		return false
+	}
+
+	return true
+}
+
+// CertificateSANs returns the DNS, email, URI and IP SANs of a certificate
+func CertificateSANs(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// Check returns an error message if the config is invalid
+func (clientCert ClientCertConfig) Check() string {
+	if verify := clientCert.GetVerify(); verify != ClientCertRequire && verify != ClientCertOptional {
+		return "Invalid client certificate Verify '" + string(clientCert.Verify) + "'"
+	}
+
+	if _, err := clientCert.LoadCAs(); err != nil {
+		return "Can't load client CAs: " + err.Error()
+	}
+
+	return ""
+}
+
+// Return true if one of the values matches one of the patterns. A '*' in a
+// pattern matches any characters
+func matchAnyPattern(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		r := RegexpStore.GetPattern("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+		if r == nil {
+			continue
+		}
+
+		for _, value := range values {
+			if r.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
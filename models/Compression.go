@@ -0,0 +1,59 @@
+package models
+
+import (
+	"github.com/JojiiOfficial/ReverseProxy/models/units"
+)
+
+// SupportedEncodings content encodings which can be used for response compression
+var SupportedEncodings = []string{"br", "zstd", "gzip"}
+
+// Content types which get compressed by default
+var defaultCompressionTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/xml",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+// CompressionConfig config for compressing responses of a location
+type CompressionConfig struct {
+	// Encodings to use, ordered by preference
+	Encodings []string `toml:",omitempty"`
+	// Content types to compress. Wildcards like text/* are allowed
+	ContentTypes []string `toml:",omitempty"`
+	// Responses smaller than MinSize won't be compressed
+	MinSize units.Datasize
+	// Decompress gzip request bodies before forwarding them
+	DecompressRequests bool
+}
+
+// GetEncodings returns the encodings to use. If not set, return all supported encodings
+func (compression CompressionConfig) GetEncodings() []string {
+	if len(compression.Encodings) == 0 {
+		return SupportedEncodings
+	}
+	return compression.Encodings
+}
+
+// GetContentTypes returns the content types to compress. If not set, return default types
+func (compression CompressionConfig) GetContentTypes() []string {
+	if len(compression.ContentTypes) == 0 {
+		return defaultCompressionTypes
+	}
+	return compression.ContentTypes
+}
+
+// GetMinSize returns the min size in bytes. If not set, return default size
+func (compression CompressionConfig) GetMinSize() int64 {
+	if compression.MinSize <= 0 {
+		return int64(units.Kilobyte.Bytes())
+	}
+	return int64(compression.MinSize.Bytes())
+}
@@ -17,6 +17,13 @@ type Config struct {
 	Server          ServerConfig `toml:"Server"`
 	ListenAddresses []ListenAddress
 	RouteFiles      []string
+	Admin           *AdminConfig
+}
+
+// AdminConfig configuration for the admin interface
+type AdminConfig struct {
+	Address string
+	Token   string
 }
 
 // ServerConfig configuration for webserver
@@ -24,6 +31,18 @@ type ServerConfig struct {
 	MaxHeaderSize units.Datasize
 	ReadTimeout   ConfigDuration
 	WriteTimeout  ConfigDuration
+	// Time after which unused keep-alive and HTTP/2 connections get closed
+	IdleTimeout ConfigDuration `toml:",omitempty"`
+	// File to write the access log to. '-' logs to stdout
+	AccessLog string `toml:",omitempty"`
+}
+
+// GetIdleTimeout returns the idle timeout of client connections. If not set, return 2 minutes
+func (serverConfig ServerConfig) GetIdleTimeout() time.Duration {
+	if serverConfig.IdleTimeout <= 0 {
+		return 2 * time.Minute
+	}
+	return time.Duration(serverConfig.IdleTimeout)
 }
 
 // ReadConfig read the config file
@@ -62,6 +81,9 @@ func CreateDefaultConfig(file, defaultPath string) (bool, error) {
 				TaskData: TaskData{
 					Redirect: RedirectData{
 						HTTPCode: 301,
+						ExceptPaths: []string{
+							"/.well-known/acme-challenge/",
+						},
 					},
 				},
 			},
@@ -174,7 +196,8 @@ func (config *Config) LoadRoutes() ([]Route, error) {
 // GetPreferredSSLAddress returns preferred SSL address
 func (config Config) GetPreferredSSLAddress() *ListenAddress {
 	for i := range config.ListenAddresses {
-		if config.ListenAddresses[i].SSL == true {
+		// Clients can't be redirected to unix sockets
+		if config.ListenAddresses[i].SSL == true && !config.ListenAddresses[i].IsUnix() {
 			return &config.ListenAddresses[i]
 		}
 	}
@@ -191,3 +214,13 @@ func (config Config) GetAddress(sAddress string) *ListenAddress {
 
 	return &ListenAddress{Address: ""}
 }
+
+// HasStreamTasks returns true if at least one address forwards raw connections
+func (config Config) HasStreamTasks() bool {
+	for i := range config.ListenAddresses {
+		if config.ListenAddresses[i].IsStreamTask() || config.ListenAddresses[i].Passthrough != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Destination schemes of FastCGI applications
+const (
+	// FastCGIScheme FastCGI over TCP
+	FastCGIScheme = "fcgi"
+	// FastCGIUnixScheme FastCGI over a unix socket
+	FastCGIUnixScheme = "fcgi+unix"
+)
+
+// FastCGIConfig config for FastCGI destinations like PHP-FPM
+type FastCGIConfig struct {
+	// Directory containing the scripts. The path relative to the location is
+	// appended to it
+	Root string
+	// Use this script for all requests instead of the requested one
+	ScriptFilename string `toml:",omitempty"`
+	// Script used for directories
+	Index string `toml:",omitempty"`
+	// Regex splitting the path into the script and PATH_INFO
+	SplitPath string `toml:",omitempty"`
+	// Additional params. Values can contain variables
+	Params map[string]string `toml:",omitempty"`
+	// Timeout for connecting to the application
+	ConnectTimeout ConfigDuration
+}
+
+// GetIndex returns the index script. If not set, return index.php
+func (fastCGI FastCGIConfig) GetIndex() string {
+	if len(fastCGI.Index) == 0 {
+		return "index.php"
+	}
+	return fastCGI.Index
+}
+
+// GetSplitPath returns the regex splitting paths. If not set, split after .php
+func (fastCGI FastCGIConfig) GetSplitPath() *regexp.Regexp {
+	if len(fastCGI.SplitPath) == 0 {
+		return RegexpStore.GetPattern(`^(.+?\.php)(/.*)?$`)
+	}
+	return RegexpStore.GetPattern(fastCGI.SplitPath)
+}
+
+// GetConnectTimeout returns the connect timeout. If not set, return 5s
+func (fastCGI FastCGIConfig) GetConnectTimeout() time.Duration {
+	if fastCGI.ConnectTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(fastCGI.ConnectTimeout)
+}
+
+// Check returns an error message if the config is invalid
+func (fastCGI FastCGIConfig) Check() string {
+	if len(fastCGI.Root) == 0 && len(fastCGI.ScriptFilename) == 0 {
+		return "Missing FastCGI Root"
+	}
+
+	if len(fastCGI.SplitPath) > 0 {
+		re, err := regexp.Compile(fastCGI.SplitPath)
+		if err != nil {
+			return "Invalid SplitPath: " + err.Error()
+		}
+		if re.NumSubexp() != 2 {
+			return "SplitPath needs two groups (script and PATH_INFO)"
+		}
+	}
+
+	return ""
+}
+
+// IsFastCGIDestination returns true if the destination is a FastCGI application
+func IsFastCGIDestination(destination string) bool {
+	for _, scheme := range []string{FastCGIScheme, FastCGIUnixScheme} {
+		if strings.HasPrefix(strings.ToLower(destination), scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
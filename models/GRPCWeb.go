@@ -0,0 +1,44 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+)
+
+// GRPCWebConfig translation of gRPC-Web calls into gRPC calls
+type GRPCWebConfig struct {
+	// Origins allowed to call the location. Uses the syntax of CORS AllowOrigins.
+	// Creates a CORS policy if the location has none
+	AllowOrigins []string `toml:",omitempty"`
+	// Additional request headers (custom metadata) allowed by the CORS policy
+	AllowHeaders []string `toml:",omitempty"`
+	// Seconds a preflight response can be cached by the client
+	MaxAge int
+}
+
+// Headers used by gRPC-Web clients
+var (
+	grpcWebRequestHeaders  = []string{"Content-Type", "X-Grpc-Web", "X-User-Agent", "Grpc-Timeout", "Authorization"}
+	grpcWebResponseHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+)
+
+// CORSConfig returns the CORS policy required by gRPC-Web clients
+func (grpcWeb GRPCWebConfig) CORSConfig() *CORSConfig {
+	return &CORSConfig{
+		AllowOrigins:  grpcWeb.AllowOrigins,
+		AllowMethods:  []string{http.MethodPost},
+		AllowHeaders:  append(append([]string{}, grpcWebRequestHeaders...), grpcWeb.AllowHeaders...),
+		ExposeHeaders: grpcWebResponseHeaders,
+		MaxAge:        grpcWeb.MaxAge,
+	}
+}
+
+// IsHTTP2Destination returns true if the destination is connected using HTTP/2
+func IsHTTP2Destination(destination string) bool {
+	for _, scheme := range []string{H2CScheme, GRPCScheme, GRPCSScheme} {
+		if strings.HasPrefix(strings.ToLower(destination), scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
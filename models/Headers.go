@@ -0,0 +1,11 @@
+package models
+
+// HeaderRules headers to add, set or remove. Values can contain variables like $client_ip
+type HeaderRules struct {
+	RequestAdd     map[string]string `toml:",omitempty"`
+	RequestSet     map[string]string `toml:",omitempty"`
+	RequestRemove  []string          `toml:",omitempty"`
+	ResponseAdd    map[string]string `toml:",omitempty"`
+	ResponseSet    map[string]string `toml:",omitempty"`
+	ResponseRemove []string          `toml:",omitempty"`
+}
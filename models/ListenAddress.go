@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"net"
 	"net/http"
 	"strings"
 )
@@ -15,17 +17,43 @@ type ListenAddress struct {
 	Task                InterfaceTask
 	TaskData            TaskData
 	IsRedirectInterface bool `toml:"-"`
+
+	// Also serve HTTP/3 (QUIC) on the UDP port of an SSL address
+	HTTP3 bool
+
+	// Accept HTTP/2 without TLS (prior knowledge) on an address without SSL, e.g. for gRPC clients
+	H2C bool
+
+	// Forward TLS connections of an SSL address by server name without terminating them
+	Passthrough *PassthroughData `toml:",omitempty"`
+
+	// Read the client address from PROXY protocol headers of load balancers
+	ProxyProtocol *ProxyProtocolConfig `toml:",omitempty"`
+
+	// File settings of unix socket addresses (unix:///run/proxy.sock)
+	UnixSocket *UnixSocketConfig `toml:",omitempty"`
 }
 
 // TaskData data for interface Task
 type TaskData struct {
 	Redirect RedirectData
+	// Data of the tcp and udp tasks
+	Stream *StreamData `toml:",omitempty"`
 }
 
 // RedirectData data for interface Task to redirect
 type RedirectData struct {
 	Body     string
 	HTTPCode int
+	// Port to redirect to. If not set, the port of the preferred SSL address is used
+	Port string `toml:",omitempty"`
+	// Canonical host to redirect to. If not set, the requested host is used
+	Host string `toml:",omitempty"`
+	// Requests with a path starting with one of these prefixes get handled by their location
+	ExceptPaths []string `toml:",omitempty"`
+	// Always redirect to the requested host first, so it can set HSTS. The SSL
+	// server redirects other server names of the route of Host to Host afterwards
+	HSTSFriendly bool
 }
 
 // InterfaceTask task for an Address interface
@@ -35,6 +63,8 @@ type InterfaceTask string
 const (
 	HTTPRedirectTask InterfaceTask = "httpredirect"
 	ProxyTask        InterfaceTask = "proxy"
+	TCPTask          InterfaceTask = "tcp"
+	UDPTask          InterfaceTask = "udp"
 )
 
 // Init inits a listenAddress
@@ -51,28 +81,71 @@ func (address *ListenAddress) GetTask() InterfaceTask {
 	return address.Task
 }
 
+// IsStreamTask returns true if the address forwards raw connections instead of HTTP
+func (address *ListenAddress) IsStreamTask() bool {
+	return address.GetTask() == TCPTask || address.GetTask() == UDPTask
+}
+
 // GetBody returns body. If empty return default body
 func (redirectData RedirectData) GetBody() string {
 	if len(redirectData.Body) == 0 {
-		return "Moved permanently"
+		return http.StatusText(redirectData.GetHTTPCode())
 	}
 	return redirectData.Body
 }
 
-// GetHTTPCode returns body. If empty return default body
+// GetHTTPCode returns the HTTP code. If empty return default code
 func (redirectData RedirectData) GetHTTPCode() int {
-	if len(redirectData.Body) == 0 {
+	if redirectData.HTTPCode == 0 {
 		return http.StatusMovedPermanently
 	}
 	return redirectData.HTTPCode
 }
 
+// Check returns an error message if the config is invalid
+func (redirectData RedirectData) Check() string {
+	switch redirectData.HTTPCode {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Sprintf("Invalid redirect HTTPCode %d, use 301, 302, 303, 307 or 308", redirectData.HTTPCode)
+	}
+	return ""
+}
+
+// IsException returns true if requests for path shouldn't be redirected
+func (redirectData RedirectData) IsException(path string) bool {
+	for _, prefix := range redirectData.ExceptPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAddress returns address of a listenAddress
 func (address ListenAddress) GetAddress() string {
 	return address.Address
 }
 
-// GetPort returns port of address
+// GetPort returns port of address. Unix sockets have no port
 func (address ListenAddress) GetPort() string {
-	return strings.Split(address.Address, ":")[1]
+	if address.IsUnix() {
+		return ""
+	}
+
+	_, port, err := net.SplitHostPort(address.Address)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// IsUnix returns true if the address is a unix socket
+func (address ListenAddress) IsUnix() bool {
+	return strings.HasPrefix(address.Address, UnixScheme+"://")
+}
+
+// SocketPath returns the file of a unix socket address
+func (address ListenAddress) SocketPath() string {
+	return strings.TrimPrefix(address.Address, UnixScheme+"://")
 }
@@ -3,11 +3,22 @@ package models
 import (
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"strings"
 
 	"github.com/JojiiOfficial/gaw"
 )
 
+// Destination schemes of upstreams speaking HTTP/2
+const (
+	// H2CScheme HTTP/2 without TLS
+	H2CScheme = "h2c"
+	// GRPCScheme gRPC without TLS
+	GRPCScheme = "grpc"
+	// GRPCSScheme gRPC using TLS
+	GRPCSScheme = "grpcs"
+)
+
 // RouteLocation location for route
 type RouteLocation struct {
 	// Toml config attributes
@@ -15,15 +26,51 @@ type RouteLocation struct {
 	Destination string
 	SrcIPHeader string
 	Regex       bool
+	Action      LocationAction `toml:",omitempty"`
 
 	// Allow/deny hosts
 	Allow []string
 	Deny  string
 
+	// Cache responses of this location
+	Cache *CacheConfig
+	// Compress responses of this location
+	Compression *CompressionConfig
+	// Serve files from a local directory instead of proxying
+	Static *StaticConfig
+	// Modify request and response headers
+	Headers *HeaderRules
+	// Security headers overriding the ones of the route
+	Security *SecurityHeaders
+	// Cross-origin resource sharing policy
+	CORS *CORSConfig
+	// Require authentication
+	Auth *LocationAuth
+	// Require a client certificate. Overrides the config of the route
+	ClientCert *ClientCertConfig
+	// Require requests to carry a valid signature and expiry
+	SignedURL *SignedURLConfig
+	// Limits of WebSocket connections
+	WebSocket *WebSocketConfig
+	// Translate gRPC-Web calls into gRPC calls
+	GRPCWeb *GRPCWebConfig
+	// Send a PROXY protocol header of this version (1 or 2) to the destination
+	SendProxyProtocol int `toml:",omitempty"`
+	// Scripts and params of fcgi:// and fcgi+unix:// destinations
+	FastCGI *FastCGIConfig
+	// Rewrite response headers of the upstream
+	Rewrite *ResponseRewrite
+	// Config for the redirect and respond actions
+	Redirect *LocationRedirect
+	Respond  *LocationResponse
+
 	// Non toml attrs
 	DestinationURL *url.URL `toml:"-"`
+	UnixSocket     string   `toml:"-"`
 	Route          *Route   `toml:"-"`
 	HasDenyRoule   bool     `toml:"-"`
+
+	SecurityPolicy *SecurityPolicy `toml:"-"`
 }
 
 // Init inits a location. Gets called on loading its assigned route
@@ -31,17 +78,73 @@ func (location *RouteLocation) Init(route *Route) {
 	location.Route = route
 	location.HasDenyRoule = strings.ToLower(location.Deny) == "all"
 	location.DestinationURL, _ = url.Parse(location.Destination)
+	if location.DestinationURL != nil && location.DestinationURL.Scheme == UnixScheme {
+		location.UnixSocket, location.DestinationURL = parseUnixDestination(location.DestinationURL)
+	}
+	location.SecurityPolicy = buildSecurityPolicy(route.Security, location.Security)
+
+	// Browsers need a CORS policy to call gRPC-Web services of other origins
+	if location.GRPCWeb != nil && location.CORS == nil && len(location.GRPCWeb.AllowOrigins) > 0 {
+		location.CORS = location.GRPCWeb.CORSConfig()
+	}
+}
+
+// RelativePath returns the part of p following the matched location
+func (location *RouteLocation) RelativePath(p string) string {
+	locationItems := gaw.TrimEmptySlice(strings.Split(location.Location, "/"))
+	pathItems := gaw.TrimEmptySlice(strings.Split(p, "/"))
+
+	if len(locationItems) > len(pathItems) {
+		return "/"
+	}
+
+	rel := "/" + strings.Join(pathItems[len(locationItems):], "/")
+	if strings.HasSuffix(p, "/") && rel != "/" {
+		rel += "/"
+	}
+	return rel
 }
 
 //Ports returns a list with ports used by the given RouteLocation
 func (location *RouteLocation) Ports() []string {
 	var ports []string
 	for _, address := range location.Route.ListenAddresses {
-		ports = append(ports, address.GetPort())
+		if port := address.GetPort(); len(port) > 0 {
+			ports = append(ports, port)
+		}
 	}
 	return ports
 }
 
+// IsLoop returns true if the destination is an address of the route
+func (location *RouteLocation) IsLoop() bool {
+	if len(location.UnixSocket) > 0 {
+		for _, address := range location.Route.ListenAddresses {
+			if address.IsUnix() && filepath.Clean(address.SocketPath()) == filepath.Clean(location.UnixSocket) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Locations without destination and fcgi+unix destinations
+	if location.DestinationURL == nil || len(location.DestinationURL.Host) == 0 {
+		return false
+	}
+
+	port := location.DestinationURL.Port()
+	if len(port) == 0 {
+		switch location.DestinationURL.Scheme {
+		case "https", "wss", GRPCSScheme:
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+
+	return isHostsAddress(location.DestinationURL.Hostname()) && gaw.IsInStringArray(port, location.Ports())
+}
+
 // ModifyProxyRequest modifies a request to a proxy forward request
 func (location RouteLocation) ModifyProxyRequest(req *http.Request) {
 	destination := location.DestinationURL
@@ -146,6 +249,38 @@ func calcMatchDepth(path, location []string, regex bool) int {
 	return matchCount
 }
 
+// Captures returns the submatches of the regex parts of the location. If a
+// regex has no groups, the whole matching path item is used
+func (location *RouteLocation) Captures(p string) []string {
+	if !location.Regex {
+		return nil
+	}
+
+	var captures []string
+	locationItems := gaw.TrimEmptySlice(strings.Split(location.Location, "/"))
+	pathItems := gaw.TrimEmptySlice(strings.Split(p, "/"))
+
+	for i := range locationItems {
+		if i >= len(pathItems) || !isRegexString(locationItems[i]) {
+			continue
+		}
+
+		r := RegexpStore.GetPattern(locationItems[i][1 : len(locationItems[i])-1])
+		if r == nil {
+			continue
+		}
+
+		match := r.FindStringSubmatch(pathItems[i])
+		if len(match) > 1 {
+			captures = append(captures, match[1:]...)
+		} else if len(match) == 1 {
+			captures = append(captures, match[0])
+		}
+	}
+
+	return captures
+}
+
 func isRegexString(str string) bool {
 	return strings.HasSuffix(str, "}") && strings.HasPrefix(str, "{")
 }
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OIDCConfig OpenID Connect login for all locations of a route
+type OIDCConfig struct {
+	// Issuer URL used for the discovery
+	Issuer       string
+	ClientID     string
+	ClientSecret string   `toml:",omitempty"`
+	Scopes       []string `toml:",omitempty"`
+	// Path of the redirect URL handled by the proxy
+	CallbackPath string `toml:",omitempty"`
+	// Path which ends the session
+	LogoutPath string `toml:",omitempty"`
+	// URL to redirect to after logging out
+	PostLogoutRedirect string `toml:",omitempty"`
+	// Secret used to encrypt the session cookie
+	CookieSecret string
+	CookieName   string `toml:",omitempty"`
+	CookieDomain string `toml:",omitempty"`
+	// Max lifetime of a session. Sessions get refreshed until then
+	SessionLifetime ConfigDuration
+	// Claim containing the username
+	UserClaim string `toml:",omitempty"`
+	// Upstream request headers set to the value of a claim
+	ClaimHeaders map[string]string `toml:",omitempty"`
+}
+
+// OIDCAuth per location requirements for users logged in using OpenID Connect
+type OIDCAuth struct {
+	// Don't require a login for this location
+	Public bool
+	// The user needs to be in one of the groups
+	Groups      []string `toml:",omitempty"`
+	GroupsClaim string   `toml:",omitempty"`
+	// Claims which have to be present. A non empty value has to match
+	RequiredClaims map[string]string `toml:",omitempty"`
+}
+
+// GetScopes returns the scopes to request. If not set, return default scopes
+func (oidc OIDCConfig) GetScopes() []string {
+	if len(oidc.Scopes) == 0 {
+		return []string{"openid", "profile", "email"}
+	}
+	return oidc.Scopes
+}
+
+// GetCallbackPath returns the callback path. If not set, return default path
+func (oidc OIDCConfig) GetCallbackPath() string {
+	if len(oidc.CallbackPath) == 0 {
+		return "/oauth2/callback"
+	}
+	return oidc.CallbackPath
+}
+
+// GetLogoutPath returns the logout path. If not set, return default path
+func (oidc OIDCConfig) GetLogoutPath() string {
+	if len(oidc.LogoutPath) == 0 {
+		return "/oauth2/logout"
+	}
+	return oidc.LogoutPath
+}
+
+// GetCookieName returns the name of the session cookie. If not set, return default name
+func (oidc OIDCConfig) GetCookieName() string {
+	if len(oidc.CookieName) == 0 {
+		return "_reverseproxy_session"
+	}
+	return oidc.CookieName
+}
+
+// GetSessionLifetime returns the max session lifetime. If not set, return default lifetime
+func (oidc OIDCConfig) GetSessionLifetime() time.Duration {
+	if oidc.SessionLifetime <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(oidc.SessionLifetime)
+}
+
+// GetUserClaim returns the claim containing the username. If not set, return 'sub'
+func (oidc OIDCConfig) GetUserClaim() string {
+	if len(oidc.UserClaim) == 0 {
+		return "sub"
+	}
+	return oidc.UserClaim
+}
+
+// GetGroupsClaim returns the claim containing the groups. If not set, return 'groups'
+func (oidc OIDCAuth) GetGroupsClaim() string {
+	if len(oidc.GroupsClaim) == 0 {
+		return "groups"
+	}
+	return oidc.GroupsClaim
+}
+
+// Check returns an error message if the config is invalid
+func (oidc OIDCConfig) Check() string {
+	u, err := url.Parse(oidc.Issuer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return "Invalid OIDC issuer '" + oidc.Issuer + "'"
+	}
+
+	if len(oidc.ClientID) == 0 {
+		return "Missing OIDC ClientID"
+	}
+
+	if len(oidc.CookieSecret) < 16 {
+		return "OIDC CookieSecret needs at least 16 characters"
+	}
+
+	for _, p := range []string{oidc.GetCallbackPath(), oidc.GetLogoutPath()} {
+		if !strings.HasPrefix(p, "/") {
+			return "OIDC path '" + p + "' has to start with a /"
+		}
+	}
+
+	return ""
+}
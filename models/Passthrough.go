@@ -0,0 +1,59 @@
+package models
+
+import "strings"
+
+// PassthroughData forwards TLS connections of an SSL address to upstreams by
+// their server name (SNI) without terminating them
+type PassthroughData struct {
+	Backends []PassthroughBackend
+	// Upstreams for server names matching neither a backend nor a route.
+	// If not set, these connections get rejected
+	Default *StreamData `toml:",omitempty"`
+}
+
+// PassthroughBackend upstreams for a set of server names
+type PassthroughBackend struct {
+	// Server names to forward. "*.example.com" matches all subdomains
+	ServerNames []string
+	Stream      StreamData
+}
+
+// MatchesServerName returns true if serverName belongs to the backend
+func (backend PassthroughBackend) MatchesServerName(serverName string) bool {
+	serverName = strings.ToLower(serverName)
+	for _, name := range backend.ServerNames {
+		name = strings.ToLower(name)
+		if name == serverName {
+			return true
+		}
+
+		if strings.HasPrefix(name, "*.") && strings.HasSuffix(serverName, name[1:]) && !strings.Contains(strings.TrimSuffix(serverName, name[1:]), ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check returns an error message if the config is invalid
+func (passthrough PassthroughData) Check() string {
+	if len(passthrough.Backends) == 0 && passthrough.Default == nil {
+		return "Missing Backends"
+	}
+
+	for _, backend := range passthrough.Backends {
+		if len(backend.ServerNames) == 0 {
+			return "Missing ServerNames of passthrough backend"
+		}
+
+		if msg := backend.Stream.Check(); len(msg) > 0 {
+			return msg
+		}
+	}
+
+	if passthrough.Default != nil {
+		return passthrough.Default.Check()
+	}
+
+	return ""
+}
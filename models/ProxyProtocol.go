@@ -0,0 +1,39 @@
+package models
+
+import (
+	"net"
+	"time"
+)
+
+// ProxyProtocolConfig accepting PROXY protocol (v1 and v2) headers on an address
+type ProxyProtocolConfig struct {
+	// IPs and CIDRs of load balancers allowed to send headers. Headers sent
+	// by other addresses aren't parsed
+	TrustedIPs []string
+	// Time to wait for the header
+	HeaderTimeout ConfigDuration
+	// Close connections of trusted IPs without header
+	Require bool
+}
+
+// IsTrusted returns true if ip is allowed to send headers
+func (config ProxyProtocolConfig) IsTrusted(ip net.IP) bool {
+	return ipInList(ip, config.TrustedIPs)
+}
+
+// GetHeaderTimeout returns the header timeout. If not set, return 5s
+func (config ProxyProtocolConfig) GetHeaderTimeout() time.Duration {
+	if config.HeaderTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(config.HeaderTimeout)
+}
+
+// Check returns an error message if the config is invalid
+func (config ProxyProtocolConfig) Check() string {
+	if len(config.TrustedIPs) == 0 {
+		return "Missing TrustedIPs"
+	}
+
+	return checkIPList(config.TrustedIPs)
+}
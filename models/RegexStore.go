@@ -2,6 +2,7 @@ package models
 
 import (
 	"regexp"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -9,6 +10,7 @@ import (
 // RegexStore store compiled regex to improve performance
 type RegexStore struct {
 	Store map[string]*regexp.Regexp
+	mutex sync.RWMutex
 }
 
 // NewRegexStore create new regex store
@@ -20,8 +22,11 @@ func NewRegexStore() *RegexStore {
 
 // GetPattern returns a regexp. If pattern not found, compile and store
 func (store *RegexStore) GetPattern(pattern string) *regexp.Regexp {
-	if regexp, ok := store.Store[pattern]; ok {
-		return regexp
+	store.mutex.RLock()
+	r, ok := store.Store[pattern]
+	store.mutex.RUnlock()
+	if ok {
+		return r
 	}
 
 	// Compile pattern
@@ -32,7 +37,9 @@ func (store *RegexStore) GetPattern(pattern string) *regexp.Regexp {
 	}
 
 	// Store pattern in RegexStore
+	store.mutex.Lock()
 	store.Store[pattern] = r
+	store.mutex.Unlock()
 
 	return r
 }
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"strings"
+)
+
+// ResponseRewrite config for rewriting response headers of an upstream
+type ResponseRewrite struct {
+	// Don't map Location, Content-Location and Refresh headers pointing to the destination
+	DisableRedirects bool
+	// Additional URL prefixes to rewrite in Location, Content-Location and Refresh headers
+	Redirects []RewriteRule `toml:",omitempty"`
+	// Rewrite the Domain attribute of cookies
+	CookieDomains []RewriteRule `toml:",omitempty"`
+	// Rewrite the Path attribute of cookies
+	CookiePaths []RewriteRule `toml:",omitempty"`
+}
+
+// RewriteRule replaces From with To. Variables like $host can be used in To
+type RewriteRule struct {
+	From string
+	To   string
+}
+
+// MatchPrefix returns true if s starts with the From value of the rule
+func (rule RewriteRule) MatchPrefix(s string) bool {
+	return len(rule.From) > 0 && strings.HasPrefix(strings.ToLower(s), strings.ToLower(rule.From))
+}
+
+// MatchDomain returns true if the cookie domain matches the From value of the rule
+func (rule RewriteRule) MatchDomain(domain string) bool {
+	return strings.EqualFold(strings.TrimPrefix(domain, "."), strings.TrimPrefix(rule.From, "."))
+}
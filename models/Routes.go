@@ -21,6 +21,10 @@ type Route struct {
 	Interfaces      []string
 	ListenAddresses []*ListenAddress `toml:"-"`
 	SSL             TLSKeyCertPair
+	Headers         *HeaderRules
+	Security        *SecurityHeaders
+	OIDC            *OIDCConfig
+	ClientCert      *ClientCertConfig
 	Locations       []RouteLocation `toml:"Location"`
 	DefaultLocation *RouteLocation  `toml:"-"`
 }
@@ -125,6 +129,30 @@ func (route Route) Check(config *Config) bool {
 		}
 	}
 
+	// Check security headers
+	if route.Security != nil {
+		if msg := route.Security.Check(); len(msg) > 0 {
+			log.Errorf("%s in %s", msg, route.FileName)
+			return false
+		}
+	}
+
+	// Check OpenID Connect login
+	if route.OIDC != nil {
+		if msg := route.OIDC.Check(); len(msg) > 0 {
+			log.Errorf("%s in %s", msg, route.FileName)
+			return false
+		}
+	}
+
+	// Check client certificate config
+	if route.ClientCert != nil {
+		if msg := route.ClientCert.Check(); len(msg) > 0 {
+			log.Errorf("%s in %s", msg, route.FileName)
+			return false
+		}
+	}
+
 	// Validate locations
 	for _, location := range route.Locations {
 		if !isURLValid(location.Destination) {
@@ -133,14 +161,126 @@ func (route Route) Check(config *Config) bool {
 		}
 
 		// Check if location points to reverseproxies address
-		port := "80"
-		if len(location.DestinationURL.Port()) > 0 {
-			port = location.DestinationURL.Port()
-		}
-		if isHostsAddress(location.DestinationURL.Hostname()) && gaw.IsInStringArray(port, location.Ports()) {
+		if location.IsLoop() {
 			log.Fatal("Error Request loop detected")
 			return false
 		}
+
+		// Check action
+		if msg := location.checkAction(); len(msg) > 0 {
+			log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+			return false
+		}
+
+		// Check static directory
+		if location.Static != nil && !location.Static.Check() {
+			log.Errorf("Static root '%s' in %s is not a directory", location.Static.Root, route.FileName)
+			return false
+		}
+
+		// Check security headers
+		if location.Security != nil {
+			if msg := location.Security.Check(); len(msg) > 0 {
+				log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// Check authentication
+		if location.Auth != nil {
+			if msg := location.Auth.Check(); len(msg) > 0 {
+				log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+				return false
+			}
+
+			if location.Auth.OIDC != nil && route.OIDC == nil {
+				log.Errorf("Location '%s' in %s requires OIDC, but the route has no OIDC config", location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// Check client certificate config
+		if location.ClientCert != nil {
+			if msg := location.ClientCert.Check(); len(msg) > 0 {
+				log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// Check signed URL config
+		if location.SignedURL != nil {
+			if msg := location.SignedURL.Check(); len(msg) > 0 {
+				log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// gRPC-Web calls get translated into HTTP/2 gRPC calls
+		if location.GRPCWeb != nil && !IsHTTP2Destination(location.Destination) {
+			log.Errorf("GRPCWeb requires a grpc://, grpcs:// or h2c:// destination for location '%s' in %s", location.Location, route.FileName)
+			return false
+		}
+
+		if IsUnixDestination(location.Destination) && len(location.UnixSocket) == 0 {
+			log.Errorf("Missing socket path for location '%s' in %s", location.Location, route.FileName)
+			return false
+		}
+
+		// FastCGI applications need to know which script to run
+		if IsFastCGIDestination(location.Destination) && location.FastCGI == nil {
+			log.Errorf("Missing FastCGI config for location '%s' in %s", location.Location, route.FileName)
+			return false
+		}
+		if location.FastCGI != nil {
+			if !IsFastCGIDestination(location.Destination) {
+				log.Errorf("FastCGI requires a fcgi:// or fcgi+unix:// destination for location '%s' in %s", location.Location, route.FileName)
+				return false
+			}
+			if msg := location.FastCGI.Check(); len(msg) > 0 {
+				log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// PROXY protocol headers contain the client address, so connections
+		// can't be shared between clients
+		if location.SendProxyProtocol != 0 {
+			if location.SendProxyProtocol != 1 && location.SendProxyProtocol != 2 {
+				log.Errorf("Invalid SendProxyProtocol version for location '%s' in %s", location.Location, route.FileName)
+				return false
+			}
+
+			if IsHTTP2Destination(location.Destination) || len(location.UnixSocket) > 0 {
+				log.Errorf("SendProxyProtocol isn't supported for HTTP/2 and unix destinations of location '%s' in %s", location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// Check WebSocket config
+		if location.WebSocket != nil {
+			if msg := location.WebSocket.Check(); len(msg) > 0 {
+				log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// Check CORS policy
+		if location.CORS != nil {
+			if msg := location.CORS.Check(); len(msg) > 0 {
+				log.Errorf("%s for location '%s' in %s", msg, location.Location, route.FileName)
+				return false
+			}
+		}
+
+		// Check compression encodings
+		if location.Compression != nil {
+			for _, encoding := range location.Compression.Encodings {
+				if !gaw.IsInStringArray(encoding, SupportedEncodings) {
+					log.Errorf("Unsupported compression encoding '%s' in %s", encoding, route.FileName)
+					return false
+				}
+			}
+		}
 	}
 
 	return true
@@ -247,6 +387,16 @@ func FindMatchingLocation(routes []*Route, r *http.Request) *RouteLocation {
 	return nil
 }
 
+// FindRouteForServerName returns the first route having host as server name
+func FindRouteForServerName(routes []*Route, host string) *Route {
+	for _, route := range routes {
+		if inStrSl(route.ServerNames, host) {
+			return route
+		}
+	}
+	return nil
+}
+
 func inStrSl(ss []string, str string) bool {
 	for _, s := range ss {
 		if str == strings.ToLower(s) {
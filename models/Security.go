@@ -0,0 +1,157 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DisabledHeader value to disable a header set by a preset or the route
+const DisabledHeader = "off"
+
+// SecurityHeaders security related response headers of a route or location
+type SecurityHeaders struct {
+	// Name of a preset to start from (basic, strict, none)
+	Preset string `toml:",omitempty"`
+	// Overwrite the headers even if the upstream has set them
+	Force bool
+
+	HSTS                            *HSTSConfig
+	ContentSecurityPolicy           string `toml:",omitempty"`
+	ContentSecurityPolicyReportOnly string `toml:",omitempty"`
+	FrameOptions                    string `toml:",omitempty"`
+	ContentTypeOptions              string `toml:",omitempty"`
+	ReferrerPolicy                  string `toml:",omitempty"`
+	PermissionsPolicy               string `toml:",omitempty"`
+}
+
+// HSTSConfig config of the Strict-Transport-Security header
+type HSTSConfig struct {
+	MaxAge            int64
+	IncludeSubDomains bool
+	Preload           bool
+	// Don't send the header
+	Disable bool
+}
+
+// SecurityPresets predefined security headers
+var SecurityPresets = map[string]SecurityHeaders{
+	"none": {},
+	"basic": {
+		HSTS:               &HSTSConfig{MaxAge: 15552000},
+		FrameOptions:       "SAMEORIGIN",
+		ContentTypeOptions: "nosniff",
+		ReferrerPolicy:     "strict-origin-when-cross-origin",
+	},
+	"strict": {
+		HSTS:                  &HSTSConfig{MaxAge: 63072000, IncludeSubDomains: true, Preload: true},
+		ContentSecurityPolicy: "default-src 'self'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'; object-src 'none'",
+		FrameOptions:          "DENY",
+		ContentTypeOptions:    "nosniff",
+		ReferrerPolicy:        "no-referrer",
+		PermissionsPolicy:     "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+	},
+}
+
+// SecurityPolicy resolved security headers of a location
+type SecurityPolicy struct {
+	// Headers to send. Doesn't contain the HSTS header
+	Headers map[string]string
+	// Value of the Strict-Transport-Security header. Only sent over TLS
+	HSTS  string
+	Force bool
+}
+
+// Value returns the value of the Strict-Transport-Security header
+func (hsts HSTSConfig) Value() string {
+	value := "max-age=" + strconv.FormatInt(hsts.MaxAge, 10)
+	if hsts.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if hsts.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// Check returns an error message if the security headers are invalid
+func (security SecurityHeaders) Check() string {
+	if _, ok := SecurityPresets[security.Preset]; len(security.Preset) > 0 && !ok {
+		return "Unknown security preset '" + security.Preset + "'"
+	}
+
+	switch strings.ToUpper(security.FrameOptions) {
+	case "", "DENY", "SAMEORIGIN", strings.ToUpper(DisabledHeader):
+	default:
+		return "Invalid FrameOptions '" + security.FrameOptions + "'"
+	}
+
+	if security.HSTS != nil && security.HSTS.MaxAge < 0 {
+		return "HSTS MaxAge can't be negative"
+	}
+
+	return ""
+}
+
+// Apply the headers of security on top of the policy
+func (policy *SecurityPolicy) apply(security *SecurityHeaders) {
+	if security.Force {
+		policy.Force = true
+	}
+
+	if security.HSTS != nil {
+		if security.HSTS.Disable {
+			policy.HSTS = ""
+		} else {
+			policy.HSTS = security.HSTS.Value()
+		}
+	}
+
+	for name, value := range map[string]string{
+		"Content-Security-Policy":             security.ContentSecurityPolicy,
+		"Content-Security-Policy-Report-Only": security.ContentSecurityPolicyReportOnly,
+		"X-Frame-Options":                     security.FrameOptions,
+		"X-Content-Type-Options":              security.ContentTypeOptions,
+		"Referrer-Policy":                     security.ReferrerPolicy,
+		"Permissions-Policy":                  security.PermissionsPolicy,
+	} {
+		switch value {
+		case "":
+		case DisabledHeader:
+			delete(policy.Headers, name)
+		default:
+			policy.Headers[name] = value
+		}
+	}
+}
+
+// Build the security policy of a location. Presets get applied first, followed
+// by the headers of the route and the headers of the location
+func buildSecurityPolicy(route, location *SecurityHeaders) *SecurityPolicy {
+	if route == nil && location == nil {
+		return nil
+	}
+
+	policy := &SecurityPolicy{
+		Headers: make(map[string]string),
+	}
+
+	for _, security := range []*SecurityHeaders{route, location} {
+		if security == nil {
+			continue
+		}
+
+		if preset, ok := SecurityPresets[security.Preset]; ok && len(security.Preset) > 0 {
+			policy.Headers = make(map[string]string)
+			policy.HSTS = ""
+			policy.apply(&preset)
+		}
+
+		policy.apply(security)
+	}
+
+	if len(policy.Headers) == 0 && len(policy.HSTS) == 0 {
+		return nil
+	}
+
+	return policy
+}
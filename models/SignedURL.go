@@ -0,0 +1,110 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Errors of signed URL verification
+var (
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrURLExpired       = errors.New("url expired")
+)
+
+// SignedURLConfig requires requests to be signed with a shared secret
+type SignedURLConfig struct {
+	// Secret used to sign the URLs
+	Secret string
+	// Include the IP of the client in the signature
+	BindIP bool
+	// Names of the query parameters
+	ExpiresParam   string `toml:",omitempty"`
+	SignatureParam string `toml:",omitempty"`
+	// Lifetime of generated URLs if none is given
+	DefaultTTL ConfigDuration
+}
+
+// GetExpiresParam returns the name of the expiry parameter. If not set, return 'expires'
+func (signedURL SignedURLConfig) GetExpiresParam() string {
+	if len(signedURL.ExpiresParam) == 0 {
+		return "expires"
+	}
+	return signedURL.ExpiresParam
+}
+
+// GetSignatureParam returns the name of the signature parameter. If not set, return 'signature'
+func (signedURL SignedURLConfig) GetSignatureParam() string {
+	if len(signedURL.SignatureParam) == 0 {
+		return "signature"
+	}
+	return signedURL.SignatureParam
+}
+
+// GetDefaultTTL returns the lifetime of generated URLs. If not set, return 1h
+func (signedURL SignedURLConfig) GetDefaultTTL() time.Duration {
+	if signedURL.DefaultTTL <= 0 {
+		return time.Hour
+	}
+	return time.Duration(signedURL.DefaultTTL)
+}
+
+// Signature calculates the signature of a path
+func (signedURL SignedURLConfig) Signature(path string, expires int64, ip string) string {
+	mac := hmac.New(sha256.New, []byte(signedURL.Secret))
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10) + "\n"))
+	if signedURL.BindIP {
+		mac.Write([]byte(ip))
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign adds the expiry and signature parameters to u
+func (signedURL SignedURLConfig) Sign(u *url.URL, expires time.Time, ip string) {
+	query := u.Query()
+	query.Set(signedURL.GetExpiresParam(), strconv.FormatInt(expires.Unix(), 10))
+	query.Set(signedURL.GetSignatureParam(), signedURL.Signature(u.Path, expires.Unix(), ip))
+	u.RawQuery = query.Encode()
+}
+
+// Verify checks the expiry and signature parameters of a request to path
+func (signedURL SignedURLConfig) Verify(path string, query url.Values, ip string, now time.Time) error {
+	sExpires := query.Get(signedURL.GetExpiresParam())
+	signature := query.Get(signedURL.GetSignatureParam())
+	if len(sExpires) == 0 || len(signature) == 0 {
+		return ErrMissingSignature
+	}
+
+	expires, err := strconv.ParseInt(sExpires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(signedURL.Signature(path, expires, ip))) {
+		return ErrInvalidSignature
+	}
+
+	if now.Unix() > expires {
+		return ErrURLExpired
+	}
+
+	return nil
+}
+
+// Check returns an error message if the config is invalid
+func (signedURL SignedURLConfig) Check() string {
+	if len(signedURL.Secret) < 16 {
+		return "SignedURL Secret needs at least 16 characters"
+	}
+
+	if signedURL.GetExpiresParam() == signedURL.GetSignatureParam() {
+		return "SignedURL parameters need different names"
+	}
+
+	return ""
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"os"
+)
+
+// StaticConfig config for serving files of a local directory
+type StaticConfig struct {
+	// Directory to serve files from
+	Root string
+	// Files to serve for directories
+	Index []string `toml:",omitempty"`
+	// Serve the index file for paths which don't exist (single page applications)
+	SPA bool
+	// Serve .br/.gz files next to the requested file if the client accepts them
+	Precompressed bool
+	// Value of the Cache-Control header
+	CacheControl string `toml:",omitempty"`
+	// Allow serving files and directories starting with a dot
+	AllowHidden bool
+	// Allow serving symlinks pointing outside of Root
+	FollowSymlinks bool
+}
+
+// GetIndex returns the index files. If not set, return default index
+func (static StaticConfig) GetIndex() []string {
+	if len(static.Index) == 0 {
+		return []string{"index.html"}
+	}
+	return static.Index
+}
+
+// Check returns true if the root directory exists
+func (static StaticConfig) Check() bool {
+	stat, err := os.Stat(static.Root)
+	return err == nil && stat.IsDir()
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// BalanceMode defines how upstreams get selected
+type BalanceMode string
+
+// ...
+const (
+	// BalanceRoundRobin uses the upstreams in turn
+	BalanceRoundRobin BalanceMode = "roundrobin"
+	// BalanceLeastConn uses the upstream with the fewest active connections
+	BalanceLeastConn BalanceMode = "leastconn"
+	// BalanceRandom uses a random upstream
+	BalanceRandom BalanceMode = "random"
+	// BalanceIPHash uses the same upstream for each client IP
+	BalanceIPHash BalanceMode = "iphash"
+)
+
+// StreamData data for interface tasks forwarding raw connections
+type StreamData struct {
+	// Upstream addresses (host:port)
+	Upstreams []string
+	Balance   BalanceMode `toml:",omitempty"`
+	// Timeout for connecting to an upstream
+	ConnectTimeout ConfigDuration
+	// Close connections without any traffic for this duration
+	IdleTimeout ConfigDuration
+	// IPs and CIDRs allowed to connect. Empty allows everyone
+	Allow []string `toml:",omitempty"`
+	// Send a PROXY protocol header of this version (1 or 2) to upstreams
+	SendProxyProtocol int `toml:",omitempty"`
+	// Max count of concurrent UDP sessions. The least recently active one is
+	// closed if a new client exceeds it
+	MaxSessions int `toml:",omitempty"`
+}
+
+// GetBalance returns the balance mode. If not set, return BalanceRoundRobin
+func (stream StreamData) GetBalance() BalanceMode {
+	if len(stream.Balance) == 0 {
+		return BalanceRoundRobin
+	}
+	return BalanceMode(strings.ToLower(string(stream.Balance)))
+}
+
+// GetConnectTimeout returns the connect timeout. If not set, return 5s
+func (stream StreamData) GetConnectTimeout() time.Duration {
+	if stream.ConnectTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(stream.ConnectTimeout)
+}
+
+// GetIdleTimeout returns the idle timeout. If not set, return 10 minutes
+func (stream StreamData) GetIdleTimeout() time.Duration {
+	if stream.IdleTimeout <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(stream.IdleTimeout)
+}
+
+// GetUDPIdleTimeout returns the idle timeout of UDP sessions. If not set, return 30s
+func (stream StreamData) GetUDPIdleTimeout() time.Duration {
+	if stream.IdleTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(stream.IdleTimeout)
+}
+
+// GetMaxSessions returns the max count of UDP sessions. If not set, return 10000
+func (stream StreamData) GetMaxSessions() int {
+	if stream.MaxSessions <= 0 {
+		return 10000
+	}
+	return stream.MaxSessions
+}
+
+// IsAllowed returns true if ip is allowed to connect
+func (stream StreamData) IsAllowed(ip net.IP) bool {
+	return len(stream.Allow) == 0 || ipInList(ip, stream.Allow)
+}
+
+// Return true if ip matches one of the IPs or CIDRs in list
+func ipInList(ip net.IP, list []string) bool {
+	for _, allowed := range list {
+		if strings.Contains(allowed, "/") {
+			if _, cidr, err := net.ParseCIDR(allowed); err == nil && cidr.Contains(ip) {
+				return true
+			}
+		} else if net.ParseIP(allowed).Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return an error message if list contains an invalid IP or CIDR
+func checkIPList(list []string) string {
+	for _, allowed := range list {
+		if strings.Contains(allowed, "/") {
+			if _, _, err := net.ParseCIDR(allowed); err != nil {
+				return "Invalid CIDR '" + allowed + "'"
+			}
+		} else if net.ParseIP(allowed) == nil {
+			return "Invalid IP '" + allowed + "'"
+		}
+	}
+
+	return ""
+}
+
+// Check returns an error message if the config is invalid
+func (stream StreamData) Check() string {
+	if len(stream.Upstreams) == 0 {
+		return "Missing Upstreams"
+	}
+
+	for _, upstream := range stream.Upstreams {
+		if _, _, err := net.SplitHostPort(upstream); err != nil {
+			return "Invalid upstream '" + upstream + "'"
+		}
+	}
+
+	switch stream.GetBalance() {
+	case BalanceRoundRobin, BalanceLeastConn, BalanceRandom, BalanceIPHash:
+	default:
+		return "Invalid Balance '" + string(stream.Balance) + "'"
+	}
+
+	switch stream.SendProxyProtocol {
+	case 0, 1, 2:
+	default:
+		return "Invalid SendProxyProtocol version"
+	}
+
+	if stream.MaxSessions < 0 {
+		return "MaxSessions can't be negative"
+	}
+
+	return checkIPList(stream.Allow)
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UnixScheme unix socket addresses (unix:///run/proxy.sock) and HTTP
+// destinations (unix:///run/app.sock or unix:///run/app.sock:/path/)
+const UnixScheme = "unix"
+
+// UnixSocketConfig file settings of unix socket addresses
+type UnixSocketConfig struct {
+	// File mode like "0660"
+	Mode string `toml:",omitempty"`
+	// Owner of the socket. Names or IDs
+	User  string `toml:",omitempty"`
+	Group string `toml:",omitempty"`
+}
+
+// GetMode returns the file mode and true if it's set
+func (config UnixSocketConfig) GetMode() (uint32, bool) {
+	if len(config.Mode) == 0 {
+		return 0, false
+	}
+	mode, err := strconv.ParseUint(config.Mode, 8, 32)
+	return uint32(mode), err == nil
+}
+
+// Check returns an error message if the config is invalid
+func (config UnixSocketConfig) Check() string {
+	if len(config.Mode) > 0 {
+		if mode, err := strconv.ParseUint(config.Mode, 8, 32); err != nil || mode > 0777 {
+			return "Invalid socket Mode '" + config.Mode + "'"
+		}
+	}
+
+	return ""
+}
+
+// IsUnixDestination returns true if the destination is a HTTP server on a unix socket
+func IsUnixDestination(destination string) bool {
+	return strings.HasPrefix(strings.ToLower(destination), UnixScheme+"://")
+}
+
+// Split a unix destination into the socket path and the URL of the HTTP
+// server. The path of the URL follows the socket path, separated by ':'
+func parseUnixDestination(destination *url.URL) (string, *url.URL) {
+	socketPath, httpPath := destination.Path, "/"
+	if i := strings.Index(destination.Path, ":"); i >= 0 {
+		socketPath, httpPath = destination.Path[:i], destination.Path[i+1:]
+	}
+
+	return socketPath, &url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     httpPath,
+		RawQuery: destination.RawQuery,
+	}
+}
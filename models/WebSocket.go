@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models/units"
+)
+
+// WebSocketConfig WebSocket connections of a location
+type WebSocketConfig struct {
+	// Deny upgrades to WebSocket connections
+	Disable bool
+	// Origins allowed to open connections. Uses the syntax of CORS AllowOrigins.
+	// Requests without an Origin header are allowed
+	AllowOrigins []string `toml:",omitempty"`
+	// Close connections without any frames for this duration
+	IdleTimeout ConfigDuration
+	// Close connections after this duration. Zero means unlimited
+	MaxLifetime ConfigDuration
+	// Max payload size of a single frame
+	MaxFrameSize units.Datasize
+	// Max payload size of a message consisting of multiple frames
+	MaxMessageSize units.Datasize
+}
+
+// GetIdleTimeout returns the idle timeout. If not set, return 10 minutes
+func (webSocket WebSocketConfig) GetIdleTimeout() time.Duration {
+	if webSocket.IdleTimeout <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(webSocket.IdleTimeout)
+}
+
+// AllowsOrigin returns true if a connection from origin is allowed
+func (webSocket WebSocketConfig) AllowsOrigin(origin string) bool {
+	if len(webSocket.AllowOrigins) == 0 || len(origin) == 0 {
+		return true
+	}
+	return CORSConfig{AllowOrigins: webSocket.AllowOrigins}.AllowsOrigin(origin)
+}
+
+// Check returns an error message if the config is invalid
+func (webSocket WebSocketConfig) Check() string {
+	if webSocket.MaxFrameSize > 0 && webSocket.MaxMessageSize > 0 && webSocket.MaxFrameSize > webSocket.MaxMessageSize {
+		return "WebSocket MaxFrameSize is bigger than MaxMessageSize"
+	}
+
+	return ""
+}
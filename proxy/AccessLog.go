@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLog writes a line in the combined log format for each request
+type AccessLog struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewAccessLog create a new access log. Use '-' to log to stdout
+func NewAccessLog(file string) (*AccessLog, error) {
+	if file == "-" {
+		return &AccessLog{writer: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessLog{writer: f}, nil
+}
+
+// Write the line of a handled request
+func (accessLog *AccessLog) write(req *http.Request, rc *requestContext, w *responseWriter) {
+	user := rc.User
+	if len(user) == 0 {
+		user = "-"
+	}
+
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %s %s %s %.3f\n",
+		clientIP(req, rc.Location),
+		user,
+		rc.StartTime.Format("02/Jan/2006:15:04:05 -0700"),
+		req.Method,
+		req.URL.RequestURI(),
+		req.Proto,
+		status,
+		w.written,
+		strconv.Quote(orDash(req.Referer())),
+		strconv.Quote(orDash(req.UserAgent())),
+		orDash(rc.RequestID),
+		time.Since(rc.StartTime).Seconds(),
+	)
+
+	accessLog.mutex.Lock()
+	io.WriteString(accessLog.writer, line)
+	accessLog.mutex.Unlock()
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
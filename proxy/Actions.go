@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Redirect a request of a location with the redirect action
+func (httpServer *HTTPServer) redirectAction(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) {
+	redirect := location.Redirect
+	target := expandVariables(redirect.Target, req, location)
+	target = redirect.BuildTarget(target, location.RelativePath(req.URL.Path), req.URL.RawQuery)
+
+	log.Debug("Redirect: -> ", target)
+	http.Redirect(w, req, target, redirect.GetCode())
+}
+
+// Answer a request of a location with the respond action
+func (httpServer *HTTPServer) respondAction(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) {
+	response := location.Respond
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	if len(response.Body) > 0 && len(w.Header().Get("Content-Type")) == 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	w.WriteHeader(response.GetCode())
+	if req.Method != http.MethodHead {
+		w.Write([]byte(response.Body))
+	}
+}
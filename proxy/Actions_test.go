@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+func TestRedirectAction(t *testing.T) {
+	tests := []struct {
+		target, request, location string
+	}{
+		{"https://new.example.com", "/old/a/b?x=1", "https://new.example.com/a/b?x=1"},
+		{"https://new.example.com/base/", "/old/a", "https://new.example.com/base/a"},
+		{"https://new.example.com/base?lang=de", "/old/a/b?x=1", "https://new.example.com/base/a/b?lang=de&x=1"},
+		{"https://new.example.com/base?lang=de#top", "/old/a", "https://new.example.com/base/a?lang=de#top"},
+		{"https://new.example.com/base?lang=de", "/old/", "https://new.example.com/base?lang=de"},
+		{"https://new.example.com/a%2Fb", "/old/c%20d", "https://new.example.com/a%2Fb/c%20d"},
+	}
+
+	for _, test := range tests {
+		route := &models.Route{ServerNames: []string{"x"}}
+		route.Locations = []models.RouteLocation{{
+			Location: "/old/",
+			Action:   models.RedirectAction,
+			Redirect: &models.LocationRedirect{Target: test.target, PreservePath: true, PreserveQuery: true},
+		}}
+		route.Locations[0].Init(route)
+
+		req := httptest.NewRequest(http.MethodGet, "http://x"+test.request, nil)
+		rec := httptest.NewRecorder()
+		(&HTTPServer{}).redirectAction(rec, req, &route.Locations[0])
+		if location := rec.Header().Get("Location"); location != test.location {
+			t.Errorf("%s + %s: expected %s, got %s", test.target, test.request, test.location, location)
+		}
+	}
+}
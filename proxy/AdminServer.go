@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Run the admin interface
+func (server *ReverseProxyServer) runAdmin() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/purge", server.handleCachePurge)
+	mux.HandleFunc("/metrics", server.handleMetrics)
+
+	log.Infof("Starting admin interface on '%s'", server.Config.Admin.Address)
+	err := http.ListenAndServe(server.Config.Admin.Address, server.adminAuth(mux))
+	if err != nil {
+		log.Error("Admin interface: ", err)
+	}
+}
+
+// Check the admin token if one is configured
+func (server *ReverseProxyServer) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := server.Config.Admin.Token
+		if len(token) > 0 {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Purge cached responses by URL or prefix. Accepts POST and PURGE requests
+// with either an 'url' or a 'prefix' query parameter
+func (server *ReverseProxyServer) handleCachePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != "PURGE" {
+		w.Header().Set("Allow", "POST, PURGE")
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var count int
+	if target := r.FormValue("url"); len(target) > 0 {
+		key, err := purgeKey(target)
+		if err != nil {
+			http.Error(w, "Invalid url", http.StatusBadRequest)
+			return
+		}
+
+		for _, cache := range server.Caches {
+			count += cache.PurgeURL(key)
+		}
+	} else if prefix := r.FormValue("prefix"); len(prefix) > 0 {
+		key, err := purgeKey(prefix)
+		if err != nil {
+			http.Error(w, "Invalid prefix", http.StatusBadRequest)
+			return
+		}
+
+		for _, cache := range server.Caches {
+			count += cache.PurgePrefix(key)
+		}
+	} else {
+		http.Error(w, "Missing url or prefix", http.StatusBadRequest)
+		return
+	}
+
+	log.Infof("Purged %d cached responses", count)
+	fmt.Fprintf(w, "Purged %d responses\n", count)
+}
+
+// Convert an URL like 'https://host/path' or 'host/path' into a cache key
+func purgeKey(target string) (string, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	requestURI := u.EscapedPath()
+	if len(u.RawQuery) > 0 {
+		requestURI += "?" + u.RawQuery
+	}
+	return cacheKey(u.Host, requestURI), nil
+}
+
+// Write the metrics in the Prometheus text format
+func (server *ReverseProxyServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.write(w)
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Authenticator authenticates requests of a location
+type Authenticator struct {
+	Config *models.LocationAuth
+
+	htpasswd *htpasswdFile
+	forward  *forwardAuthClient
+	jwt      *jwtValidator
+	oidc     *OIDCProvider
+}
+
+// NewAuthenticator create a new authenticator for an auth config
+func NewAuthenticator(config *models.LocationAuth) *Authenticator {
+	auth := &Authenticator{
+		Config: config,
+	}
+
+	if config.Basic != nil {
+		auth.htpasswd = newHtpasswdFile(config.Basic.HtpasswdFile)
+	}
+	if config.Forward != nil {
+		auth.forward = newForwardAuthClient(config.Forward)
+	}
+	if config.JWT != nil {
+		auth.jwt = newJWTValidator(config.JWT)
+	}
+
+	return auth
+}
+
+// Authenticate a request. All configured methods have to succeed. Returns the
+// username and true on success. Otherwise the response has been written already
+func (auth *Authenticator) authenticate(w http.ResponseWriter, req *http.Request) (string, bool) {
+	var user string
+
+	if auth.Config.Basic != nil {
+		name, ok := auth.basicAuth(w, req)
+		if !ok {
+			return "", false
+		}
+		user = name
+	}
+
+	if auth.jwt != nil {
+		name, ok := auth.jwt.authenticate(w, req)
+		if !ok {
+			return "", false
+		}
+		if len(name) > 0 {
+			user = name
+		}
+	}
+
+	if auth.oidc != nil {
+		name, ok := auth.oidc.authenticate(w, req, auth.Config.OIDC)
+		if !ok {
+			return "", false
+		}
+		if len(name) > 0 {
+			user = name
+		}
+	}
+
+	if auth.forward != nil {
+		name, ok := auth.forward.authenticate(w, req)
+		if !ok {
+			return "", false
+		}
+		if len(name) > 0 {
+			user = name
+		}
+	}
+
+	return user, true
+}
+
+// Check the basic auth credentials of a request
+func (auth *Authenticator) basicAuth(w http.ResponseWriter, req *http.Request) (string, bool) {
+	user, password, ok := req.BasicAuth()
+	if ok && auth.htpasswd.Verify(user, password) {
+		return user, true
+	}
+
+	if ok {
+		log.Debugf("Invalid login for user '%s' from %s", user, req.RemoteAddr)
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+auth.Config.Basic.GetRealm()+`", charset="UTF-8"`)
+	http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+	return "", false
+}
+
+// Check the IP allow list and the authentication of a location. Returns false
+// if the request was denied and a response has been written
+func (httpServer *HTTPServer) checkAccess(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) bool {
+	ipAllowed := isRequestAllowed(req, location)
+
+	auth, ok := httpServer.Auths[location]
+	if !ok {
+		if !ipAllowed {
+			log.Debugf("IP %s is not allowed", req.RemoteAddr)
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+		}
+		return ipAllowed
+	}
+
+	// Don't let clients send their own username
+	if len(auth.Config.UserHeader) > 0 {
+		req.Header.Del(auth.Config.UserHeader)
+	}
+
+	switch auth.Config.GetSatisfy() {
+	case models.SatisfyAny:
+		// Trusted IPs don't need to log in
+		if location.HasDenyRoule && ipAllowed {
+			return true
+		}
+	default:
+		if !ipAllowed {
+			log.Debugf("IP %s is not allowed", req.RemoteAddr)
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return false
+		}
+	}
+
+	user, ok := auth.authenticate(w, req)
+	if !ok {
+		return false
+	}
+
+	getRequestContext(req).User = user
+	if len(auth.Config.UserHeader) > 0 && len(user) > 0 {
+		req.Header.Set(auth.Config.UserHeader, user)
+	}
+
+	return true
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// upstream an address connections can be forwarded to
+type upstream struct {
+	address string
+	active  int64
+}
+
+// balancer selects the upstream of a connection
+type balancer struct {
+	mode      models.BalanceMode
+	upstreams []*upstream
+	next      uint32
+}
+
+func newBalancer(mode models.BalanceMode, addresses []string) *balancer {
+	b := &balancer{mode: mode}
+	for _, address := range addresses {
+		b.upstreams = append(b.upstreams, &upstream{address: address})
+	}
+	return b
+}
+
+// Return all upstreams in the order they should be tried. The first one is
+// selected by the balance mode, the others are used if it's unreachable
+func (b *balancer) candidates(clientIP string) []*upstream {
+	count := len(b.upstreams)
+	if count == 0 {
+		return nil
+	}
+
+	var first int
+	switch b.mode {
+	case models.BalanceLeastConn:
+		for i, u := range b.upstreams {
+			if atomic.LoadInt64(&u.active) < atomic.LoadInt64(&b.upstreams[first].active) {
+				first = i
+			}
+		}
+	case models.BalanceRandom:
+		first = rand.Intn(count)
+	case models.BalanceIPHash:
+		hash := fnv.New32a()
+		hash.Write([]byte(clientIP))
+		first = int(hash.Sum32() % uint32(count))
+	default:
+		first = int((atomic.AddUint32(&b.next, 1) - 1) % uint32(count))
+	}
+
+	candidates := make([]*upstream, 0, count)
+	for i := 0; i < count; i++ {
+		candidates = append(candidates, b.upstreams[(first+i)%count])
+	}
+	return candidates
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/JojiiOfficial/gaw"
+	log "github.com/sirupsen/logrus"
+)
+
+// Return true if req is a CORS preflight request
+func isPreflightRequest(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		len(req.Header.Get("Origin")) > 0 &&
+		len(req.Header.Get("Access-Control-Request-Method")) > 0
+}
+
+// Answer a CORS preflight request without contacting the upstream
+func (httpServer *HTTPServer) corsPreflight(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) {
+	// Preflight requests don't carry credentials
+	satisfyAny := location.Auth != nil && location.Auth.GetSatisfy() == models.SatisfyAny
+	if !satisfyAny && !isRequestAllowed(req, location) {
+		log.Debugf("IP %s is not allowed", req.RemoteAddr)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	cors := location.CORS
+	header := w.Header()
+	addHeaderToken(header, "Vary", "Access-Control-Request-Method")
+	addHeaderToken(header, "Vary", "Access-Control-Request-Headers")
+
+	method := req.Header.Get("Access-Control-Request-Method")
+	if !cors.AllowsOrigin(req.Header.Get("Origin")) || !cors.AllowsMethod(method) {
+		log.Debugf("CORS preflight for %s %s from '%s' denied", method, req.URL.Path, req.Header.Get("Origin"))
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// All requested headers have to be allowed
+	var requestedHeaders []string
+	for _, value := range req.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) == 0 {
+				continue
+			}
+			if !cors.AllowsHeader(name) {
+				log.Debugf("CORS preflight with header '%s' denied", name)
+				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				return
+			}
+			requestedHeaders = append(requestedHeaders, name)
+		}
+	}
+
+	if gaw.IsInStringArray("*", cors.GetAllowMethods()) {
+		header.Set("Access-Control-Allow-Methods", method)
+	} else {
+		header.Set("Access-Control-Allow-Methods", strings.Join(cors.GetAllowMethods(), ", "))
+	}
+	if len(requestedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+	if cors.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Add the CORS headers of a location to a response header
+func applyCORSHeaders(header http.Header, req *http.Request, cors *models.CORSConfig) {
+	// Preflight requests are answered by the proxy itself
+	if cors.OverrideUpstream && !isPreflightRequest(req) {
+		for name := range header {
+			if strings.HasPrefix(name, "Access-Control-") {
+				header.Del(name)
+			}
+		}
+	} else if len(header.Get("Access-Control-Allow-Origin")) > 0 && !isPreflightRequest(req) {
+		// Keep the headers of the upstream
+		return
+	}
+
+	origin := req.Header.Get("Origin")
+	if cors.AllowsAnyOrigin() && !cors.AllowCredentials {
+		if len(origin) > 0 {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+	} else {
+		// The response depends on the origin
+		addHeaderToken(header, "Vary", "Origin")
+		if !cors.AllowsOrigin(origin) {
+			return
+		}
+
+		header.Set("Access-Control-Allow-Origin", origin)
+		if cors.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	if len(cors.ExposeHeaders) > 0 && !isPreflightRequest(req) {
+		header.Set("Access-Control-Expose-Headers", strings.Join(cors.ExposeHeaders, ", "))
+	}
+}
@@ -0,0 +1,472 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// ResponseCache caches responses of a location in memory and optionally on disk
+type ResponseCache struct {
+	Config *models.CacheConfig
+
+	mutex    sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	size     int64
+	varies   map[string][]string
+	inflight map[string]*cacheCall
+	disk     *diskCache
+}
+
+// cacheEntry a stored response
+type cacheEntry struct {
+	Key          string
+	Vary         []string
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+// memoryItem an element of the lru list
+type memoryItem struct {
+	key   string
+	entry *cacheEntry
+}
+
+// cacheCall an upstream request which other requests with the same key can wait for
+type cacheCall struct {
+	done chan struct{}
+}
+
+// NewResponseCache create a new response cache
+func NewResponseCache(config *models.CacheConfig) *ResponseCache {
+	cache := &ResponseCache{
+		Config:   config,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		varies:   make(map[string][]string),
+		inflight: make(map[string]*cacheCall),
+	}
+
+	// Load persisted responses
+	if len(config.Directory) > 0 {
+		disk, err := newDiskCache(config.Directory, config.GetMaxDiskSize())
+		if err != nil {
+			log.Errorf("Can't use cache directory '%s': %s", config.Directory, err)
+		} else {
+			cache.disk = disk
+			for key, vary := range disk.varies {
+				cache.varies[key] = vary
+			}
+		}
+	}
+
+	return cache
+}
+
+func (entry *cacheEntry) size() int64 {
+	size := int64(len(entry.Body) + len(entry.Key))
+	for key, values := range entry.Header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// Return the key of the variant of the primary key matching req
+func variantKey(key string, vary []string, req *http.Request) string {
+	if len(vary) == 0 {
+		return key
+	}
+
+	var sb strings.Builder
+	sb.WriteString(key)
+	for _, name := range vary {
+		sb.WriteString("\n")
+		sb.WriteString(name)
+		sb.WriteString(":")
+		sb.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return sb.String()
+}
+
+// Parse the Vary header of a response. Returns false if the response varies on everything
+func parseVary(header http.Header) ([]string, bool) {
+	var vary []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if len(name) > 0 {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	sort.Strings(vary)
+	return vary, true
+}
+
+// Get returns the stored response for the request or nil if nothing was found
+func (cache *ResponseCache) get(key string, req *http.Request) *cacheEntry {
+	cache.mutex.Lock()
+	fullKey := variantKey(key, cache.varies[key], req)
+	if element, ok := cache.entries[fullKey]; ok {
+		cache.lru.MoveToFront(element)
+		cache.mutex.Unlock()
+		return element.Value.(*memoryItem).entry
+	}
+	cache.mutex.Unlock()
+
+	if cache.disk == nil {
+		return nil
+	}
+
+	// Try to load the response from disk
+	entry := cache.disk.get(fullKey)
+	if entry != nil {
+		cache.putMemory(fullKey, entry)
+	}
+	return entry
+}
+
+// Store a response
+func (cache *ResponseCache) put(entry *cacheEntry, req *http.Request) {
+	fullKey := variantKey(entry.Key, entry.Vary, req)
+
+	cache.mutex.Lock()
+	// Drop all variants if the varying headers have changed
+	vary, ok := cache.varies[entry.Key]
+	varyChanged := ok && strings.Join(vary, ",") != strings.Join(entry.Vary, ",")
+	isVariant := func(key string) bool {
+		return key == entry.Key || strings.HasPrefix(key, entry.Key+"\n")
+	}
+	if varyChanged {
+		cache.removeLocked(isVariant)
+	}
+	cache.varies[entry.Key] = entry.Vary
+	cache.mutex.Unlock()
+
+	if varyChanged && cache.disk != nil {
+		cache.disk.remove(isVariant)
+	}
+
+	cache.putMemory(fullKey, entry)
+	if cache.disk != nil {
+		cache.disk.put(fullKey, entry)
+	}
+}
+
+func (cache *ResponseCache) putMemory(fullKey string, entry *cacheEntry) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[fullKey]; ok {
+		cache.size -= element.Value.(*memoryItem).entry.size()
+		cache.lru.Remove(element)
+	}
+
+	cache.entries[fullKey] = cache.lru.PushFront(&memoryItem{key: fullKey, entry: entry})
+	cache.size += entry.size()
+
+	// Evict least recently used responses
+	maxSize := cache.Config.GetMaxSize()
+	for cache.size > maxSize && cache.lru.Len() > 1 {
+		last := cache.lru.Back()
+		item := last.Value.(*memoryItem)
+		cache.lru.Remove(last)
+		cache.size -= item.entry.size()
+		delete(cache.entries, item.key)
+	}
+}
+
+// Purge removes all responses matching the given function. Returns the count of removed responses
+func (cache *ResponseCache) Purge(match func(key string) bool) int {
+	cache.mutex.Lock()
+	count := cache.removeLocked(match)
+	cache.mutex.Unlock()
+
+	if cache.disk != nil {
+		diskCount := cache.disk.remove(match)
+		if diskCount > count {
+			count = diskCount
+		}
+	}
+
+	return count
+}
+
+// PurgeURL removes all variants of a URL
+func (cache *ResponseCache) PurgeURL(key string) int {
+	return cache.Purge(func(k string) bool {
+		return k == key || strings.HasPrefix(k, key+"\n")
+	})
+}
+
+// PurgePrefix removes all responses of URLs starting with prefix
+func (cache *ResponseCache) PurgePrefix(prefix string) int {
+	return cache.Purge(func(k string) bool {
+		return strings.HasPrefix(k, prefix)
+	})
+}
+
+func (cache *ResponseCache) removeLocked(match func(key string) bool) int {
+	var count int
+	for key, element := range cache.entries {
+		if match(key) {
+			cache.size -= element.Value.(*memoryItem).entry.size()
+			cache.lru.Remove(element)
+			delete(cache.entries, key)
+			count++
+		}
+	}
+
+	for key := range cache.varies {
+		if match(key) {
+			delete(cache.varies, key)
+		}
+	}
+
+	return count
+}
+
+// Join a running upstream request for key. Returns the call and true if the caller
+// has to do the upstream request itself
+func (cache *ResponseCache) acquire(key string) (*cacheCall, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if call, ok := cache.inflight[key]; ok {
+		return call, false
+	}
+
+	call := &cacheCall{done: make(chan struct{})}
+	cache.inflight[key] = call
+	return call, true
+}
+
+// Release a call created by acquire
+func (cache *ResponseCache) release(key string, call *cacheCall) {
+	cache.mutex.Lock()
+	if cache.inflight[key] == call {
+		delete(cache.inflight, key)
+	}
+	cache.mutex.Unlock()
+	close(call.done)
+}
+
+// --- Disk
+
+// diskCache persists cached responses in a directory
+type diskCache struct {
+	dir     string
+	maxSize int64
+
+	mutex  sync.Mutex
+	index  map[string]diskItem
+	varies map[string][]string
+	size   int64
+}
+
+type diskItem struct {
+	file   string
+	size   int64
+	stored time.Time
+}
+
+func newDiskCache(dir string, maxSize int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	disk := &diskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		index:   make(map[string]diskItem),
+		varies:  make(map[string][]string),
+	}
+
+	// Remove files of writes which didn't finish
+	tmpFiles, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	for _, file := range tmpFiles {
+		os.Remove(file)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cache"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Rebuild index from stored files
+	for _, file := range files {
+		entry, err := readCacheFile(file)
+		if err != nil {
+			log.Warnf("Removing broken cache file '%s': %s", file, err)
+			os.Remove(file)
+			continue
+		}
+
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		fullKey := variantKeyFromEntry(entry)
+		disk.index[fullKey] = diskItem{file: file, size: stat.Size(), stored: stat.ModTime()}
+		disk.varies[entry.Key] = entry.Vary
+		disk.size += stat.Size()
+	}
+
+	return disk, nil
+}
+
+// Stored entries keep the values of the varying request headers in their header
+// to be able to rebuild the full key on startup
+const varyValuesHeader = "X-Reverseproxy-Vary-Key"
+
+func variantKeyFromEntry(entry *cacheEntry) string {
+	if len(entry.Vary) == 0 {
+		return entry.Key
+	}
+	return entry.Key + "\n" + entry.Header.Get(varyValuesHeader)
+}
+
+func readCacheFile(file string) (*cacheEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entry cacheEntry
+	if err := gob.NewDecoder(f).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (disk *diskCache) fileName(fullKey string) string {
+	hash := sha256.Sum256([]byte(fullKey))
+	return filepath.Join(disk.dir, hex.EncodeToString(hash[:])+".cache")
+}
+
+func (disk *diskCache) get(fullKey string) *cacheEntry {
+	disk.mutex.Lock()
+	item, ok := disk.index[fullKey]
+	disk.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+
+	entry, err := readCacheFile(item.file)
+	if err != nil {
+		log.Warn(err)
+		return nil
+	}
+
+	entry.Header.Del(varyValuesHeader)
+	return entry
+}
+
+func (disk *diskCache) put(fullKey string, entry *cacheEntry) {
+	// Remember the variant part of the key
+	stored := *entry
+	stored.Header = entry.Header.Clone()
+	if len(entry.Vary) > 0 {
+		stored.Header.Set(varyValuesHeader, strings.TrimPrefix(fullKey, entry.Key+"\n"))
+	}
+
+	// Concurrent writers of the same key use their own temporary files
+	file := disk.fileName(fullKey)
+	f, err := os.CreateTemp(disk.dir, "*.tmp")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	tmpFile := f.Name()
+
+	if err = gob.NewEncoder(f).Encode(&stored); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		log.Error(err)
+		return
+	}
+	f.Close()
+
+	if err = os.Rename(tmpFile, file); err != nil {
+		os.Remove(tmpFile)
+		log.Error(err)
+		return
+	}
+
+	stat, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	if old, ok := disk.index[fullKey]; ok {
+		disk.size -= old.size
+	}
+	disk.index[fullKey] = diskItem{file: file, size: stat.Size(), stored: time.Now()}
+	disk.varies[entry.Key] = entry.Vary
+	disk.size += stat.Size()
+
+	// Remove oldest files if the cache got too big
+	for disk.size > disk.maxSize && len(disk.index) > 1 {
+		var oldestKey string
+		var oldest diskItem
+		for key, item := range disk.index {
+			if len(oldestKey) == 0 || item.stored.Before(oldest.stored) {
+				oldestKey, oldest = key, item
+			}
+		}
+
+		os.Remove(oldest.file)
+		disk.size -= oldest.size
+		delete(disk.index, oldestKey)
+	}
+}
+
+func (disk *diskCache) remove(match func(key string) bool) int {
+	disk.mutex.Lock()
+	defer disk.mutex.Unlock()
+
+	var count int
+	for key, item := range disk.index {
+		if match(key) {
+			os.Remove(item.file)
+			disk.size -= item.size
+			delete(disk.index, key)
+			count++
+		}
+	}
+
+	for key := range disk.varies {
+		if match(key) {
+			delete(disk.varies, key)
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,567 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fetchFunc forwards a request to the upstream
+type fetchFunc func(req *http.Request) (*http.Response, error)
+
+// Status codes which are cacheable by default (RFC 9110 15.1)
+var heuristicallyCacheable = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// Heuristic freshness is capped to this duration
+const maxHeuristicLifetime = 24 * time.Hour
+
+// cacheControl parsed Cache-Control directives
+type cacheControl map[string]string
+
+// Parse the Cache-Control header
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range splitHeaderList(value) {
+			name, arg := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, arg = directive[:i], strings.Trim(directive[i+1:], "\"")
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(arg)
+		}
+	}
+	return cc
+}
+
+// Split a comma separated header value respecting quoted strings
+func splitHeaderList(value string) []string {
+	var items []string
+	var quoted bool
+	start := 0
+	for i, c := range value {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			items = append(items, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+	items = append(items, strings.TrimSpace(value[start:]))
+	return items
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// Return the value of a delta-seconds directive
+func (cc cacheControl) duration(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// Return the date value of a header or zero time
+func headerTime(header http.Header, name string) time.Time {
+	t, err := http.ParseTime(header.Get(name))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Return the freshness lifetime of a stored response (RFC 9111 4.2.1)
+func (entry *cacheEntry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(entry.Header)
+	if maxAge, ok := cc.duration("s-maxage"); ok {
+		return maxAge
+	}
+	if maxAge, ok := cc.duration("max-age"); ok {
+		return maxAge
+	}
+
+	date := headerTime(entry.Header, "Date")
+	if date.IsZero() {
+		date = entry.ResponseTime
+	}
+
+	if len(entry.Header.Values("Expires")) > 0 {
+		// Invalid dates represent a time in the past
+		expires := headerTime(entry.Header, "Expires")
+		if expires.IsZero() || expires.Before(date) {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+
+	// Use heuristic freshness
+	lastModified := headerTime(entry.Header, "Last-Modified")
+	if heuristicallyCacheable[entry.StatusCode] && !lastModified.IsZero() && lastModified.Before(date) {
+		lifetime := date.Sub(lastModified) / 10
+		if lifetime > maxHeuristicLifetime {
+			lifetime = maxHeuristicLifetime
+		}
+		return lifetime
+	}
+
+	return 0
+}
+
+// Return the current age of a stored response (RFC 9111 4.2.3)
+func (entry *cacheEntry) currentAge(now time.Time) time.Duration {
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(entry.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+
+	apparentAge := time.Duration(0)
+	if date := headerTime(entry.Header, "Date"); !date.IsZero() && entry.ResponseTime.After(date) {
+		apparentAge = entry.ResponseTime.Sub(date)
+	}
+
+	responseDelay := entry.ResponseTime.Sub(entry.RequestTime)
+	correctedAge := ageValue + responseDelay
+	if apparentAge > correctedAge {
+		correctedAge = apparentAge
+	}
+
+	return correctedAge + now.Sub(entry.ResponseTime)
+}
+
+// Return true if the stored response is allowed to be used within stale directive
+func (entry *cacheEntry) staleUsable(directive string, staleness time.Duration, reqCC cacheControl) bool {
+	cc := parseCacheControl(entry.Header)
+	if cc.has("must-revalidate") || cc.has("proxy-revalidate") || cc.has("s-maxage") {
+		return false
+	}
+
+	if window, ok := cc.duration(directive); ok && staleness <= window {
+		return true
+	}
+	if window, ok := reqCC.duration(directive); ok && staleness <= window {
+		return true
+	}
+	return false
+}
+
+// Build a http response from a stored response
+func (entry *cacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := entry.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(entry.currentAge(now)/time.Second), 10))
+
+	return buildResponse(req, entry.StatusCode, string(entry.Body), strconv.Itoa(entry.StatusCode)+" "+http.StatusText(entry.StatusCode), header)
+}
+
+// Return true if a response is allowed to be stored by a shared cache (RFC 9111 3)
+func isStorable(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+
+	// Responses to partial requests aren't stored
+	if resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusNotModified || len(req.Header.Get("Range")) > 0 {
+		return false
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	cc := parseCacheControl(resp.Header)
+	if reqCC.has("no-store") || cc.has("no-store") || cc.has("private") {
+		return false
+	}
+
+	// Don't share personalized responses
+	if len(resp.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	if len(req.Header.Get("Authorization")) > 0 && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return false
+	}
+
+	if _, ok := parseVary(resp.Header); !ok {
+		return false
+	}
+
+	explicit := cc.has("max-age") || cc.has("s-maxage") || cc.has("public") || len(resp.Header.Values("Expires")) > 0
+	validator := len(resp.Header.Get("ETag")) > 0 || len(resp.Header.Get("Last-Modified")) > 0
+	return explicit || (heuristicallyCacheable[resp.StatusCode] && validator)
+}
+
+// Return true if the conditional headers of req match the stored response
+func notModified(req *http.Request, header http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); len(inm) > 0 {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if len(etag) == 0 {
+			return false
+		}
+		for _, tag := range splitHeaderList(inm) {
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := headerTime(req.Header, "If-Modified-Since"); !ims.IsZero() {
+		lastModified := headerTime(header, "Last-Modified")
+		return !lastModified.IsZero() && !lastModified.After(ims)
+	}
+
+	return false
+}
+
+// Build a 304 response for a stored response
+func notModifiedResponse(req *http.Request, entry *cacheEntry) *http.Response {
+	header := make(http.Header)
+	for _, name := range []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"} {
+		if values := entry.Header.Values(name); len(values) > 0 {
+			header[name] = values
+		}
+	}
+	return buildResponse(req, http.StatusNotModified, "", "304 Not Modified", header)
+}
+
+// RoundTrip serves a request from the cache or forwards it to the upstream using fetch
+func (cache *ResponseCache) RoundTrip(req *http.Request, key string, fetch fetchFunc) (*http.Response, error) {
+	// Unsafe requests invalidate stored responses (RFC 9111 4.4)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp, err := fetch(req.Clone(req.Context()))
+		if err == nil && req.Method != http.MethodOptions && resp.StatusCode < 400 {
+			cache.invalidate(req, key, resp)
+		}
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if len(req.Header.Values("Cache-Control")) == 0 && strings.Contains(strings.ToLower(req.Header.Get("Pragma")), "no-cache") {
+		reqCC["no-cache"] = ""
+	}
+
+	entry := cache.get(key, req)
+	if entry == nil {
+		if reqCC.has("only-if-cached") {
+			return buildResponse(req, http.StatusGatewayTimeout, "504 Gateway Timeout", "504 Gateway Timeout", nil), nil
+		}
+		return cache.fetchCoalesced(req, key, fetch)
+	}
+
+	now := time.Now()
+	age := entry.currentAge(now)
+	lifetime := entry.freshnessLifetime()
+	cc := parseCacheControl(entry.Header)
+
+	// Check whether the stored response can be used without validation
+	fresh := lifetime > age
+	if maxAge, ok := reqCC.duration("max-age"); ok && age > maxAge {
+		fresh = false
+	}
+	if minFresh, ok := reqCC.duration("min-fresh"); ok && lifetime-age < minFresh {
+		fresh = false
+	}
+	if maxStale, ok := reqCC["max-stale"]; ok && !fresh && !cc.has("must-revalidate") {
+		if staleLimit, valid := reqCC.duration("max-stale"); len(maxStale) == 0 || (valid && age-lifetime <= staleLimit) {
+			fresh = true
+		}
+	}
+	mustValidate := reqCC.has("no-cache") || cc.has("no-cache")
+
+	if fresh && !mustValidate {
+		log.Debug("Cache hit: ", key)
+		return cache.serve(req, entry, now), nil
+	}
+
+	// Serve stale response while revalidating in background
+	if !mustValidate && entry.staleUsable("stale-while-revalidate", age-lifetime, reqCC) {
+		log.Debug("Cache stale, revalidating in background: ", key)
+		// The request context of the location is needed to forward the request
+		bgReq := withRequestContext(req.Clone(context.Background()), getRequestContext(req))
+		go cache.revalidateBackground(bgReq, key, entry, fetch)
+		return cache.serve(req, entry, now), nil
+	}
+
+	log.Debug("Cache revalidate: ", key)
+	resp, err := cache.revalidate(req, key, entry, fetch)
+	if err != nil || resp.StatusCode >= 500 {
+		if entry.staleUsable("stale-if-error", age-lifetime, reqCC) {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			log.Debug("Cache serving stale response due to error: ", key)
+			return cache.serve(req, entry, now), nil
+		}
+	}
+
+	return resp, err
+}
+
+// Serve a stored response and take care of conditional requests
+func (cache *ResponseCache) serve(req *http.Request, entry *cacheEntry, now time.Time) *http.Response {
+	if entry.StatusCode == http.StatusOK && notModified(req, entry.Header) {
+		return notModifiedResponse(upstreamRequest(req), entry)
+	}
+	return entry.response(upstreamRequest(req), now)
+}
+
+// Return the request as it would have been sent to the upstream. Stored
+// responses get the upstream URL, so their headers are rewritten like the ones
+// of forwarded responses
+func upstreamRequest(req *http.Request) *http.Request {
+	location := getRequestContext(req).Location
+	if location == nil || location.FastCGI != nil {
+		return req
+	}
+
+	outreq := req.Clone(req.Context())
+	location.ModifyProxyRequest(outreq)
+	return outreq
+}
+
+// Forward a request whose response isn't cached. Concurrent requests for the
+// same key wait for the first one to be finished
+func (cache *ResponseCache) fetchCoalesced(req *http.Request, key string, fetch fetchFunc) (*http.Response, error) {
+	call, leader := cache.acquire(key)
+	if !leader {
+		select {
+		case <-call.done:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		if entry := cache.get(key, req); entry != nil && !parseCacheControl(entry.Header).has("no-cache") {
+			return cache.serve(req, entry, time.Now()), nil
+		}
+
+		// The response wasn't stored, fetch it on our own
+		return cache.fetchAndStore(req, key, fetch, nil)
+	}
+
+	resp, err := cache.fetchAndStore(req, key, fetch, func() {
+		cache.release(key, call)
+	})
+	return resp, err
+}
+
+// Forward a request and store its response. done gets called after the response was stored
+// or it turned out that the response can't be stored
+func (cache *ResponseCache) fetchAndStore(req *http.Request, key string, fetch fetchFunc, done func()) (*http.Response, error) {
+	if done == nil {
+		done = func() {}
+	}
+
+	// fetch modifies the request. The headers of the client are needed for
+	// the variant key of the response
+	outreq := req.Clone(req.Context())
+
+	// Conditional headers of the client would lead to unstorable 304 responses
+	if req.Method == http.MethodHead || len(req.Header.Get("If-None-Match")) > 0 || len(req.Header.Get("If-Modified-Since")) > 0 {
+		outreq.Method = http.MethodGet
+		outreq.Header.Del("If-None-Match")
+		outreq.Header.Del("If-Modified-Since")
+	}
+
+	requestTime := time.Now()
+	resp, err := fetch(outreq)
+	if err != nil {
+		done()
+		return nil, err
+	}
+
+	return cache.store(req, outreq, key, resp, requestTime, done), nil
+}
+
+// Store the response of outreq if allowed. done gets called after the response was
+// stored or it turned out that the response can't be stored
+func (cache *ResponseCache) store(req, outreq *http.Request, key string, resp *http.Response, requestTime time.Time, done func()) *http.Response {
+	if !isStorable(outreq, resp) || resp.ContentLength > cache.Config.GetMaxEntrySize() {
+		done()
+		return cache.answerClient(req, resp)
+	}
+
+	vary, _ := parseVary(resp.Header)
+	entry := &cacheEntry{
+		Key:          key,
+		Vary:         vary,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: time.Now(),
+	}
+
+	// Store the body while it gets streamed to the client
+	resp.Body = &cacheTeeBody{
+		body:  resp.Body,
+		limit: cache.Config.GetMaxEntrySize(),
+		onComplete: func(body []byte) {
+			entry.Body = body
+			cache.put(entry, req)
+			log.Debug("Cache stored: ", key)
+		},
+		onDone: done,
+	}
+
+	return cache.answerClient(req, resp)
+}
+
+// Adjust an upstream response fetched with a modified request to the clients request
+func (cache *ResponseCache) answerClient(req *http.Request, resp *http.Response) *http.Response {
+	if resp.StatusCode == http.StatusOK && notModified(req, resp.Header) {
+		// Read the body into the cache before answering with 304
+		if tee, ok := resp.Body.(*cacheTeeBody); ok {
+			io.Copy(io.Discard, io.LimitReader(tee, tee.limit+1))
+		}
+		resp.Body.Close()
+		entry := &cacheEntry{Header: resp.Header}
+		return notModifiedResponse(resp.Request, entry)
+	}
+	return resp
+}
+
+// Revalidate a stored response using a conditional request
+func (cache *ResponseCache) revalidate(req *http.Request, key string, entry *cacheEntry, fetch fetchFunc) (*http.Response, error) {
+	outreq := req.Clone(req.Context())
+	outreq.Method = http.MethodGet
+	outreq.Header.Del("If-None-Match")
+	outreq.Header.Del("If-Modified-Since")
+	if etag := entry.Header.Get("ETag"); len(etag) > 0 {
+		outreq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); len(lastModified) > 0 {
+		outreq.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := time.Now()
+	resp, err := fetch(outreq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store the new response
+	if resp.StatusCode != http.StatusNotModified {
+		return cache.store(req, outreq, key, resp, requestTime, func() {}), nil
+	}
+	resp.Body.Close()
+
+	// Freshen the stored response (RFC 9111 4.3.4)
+	updated := *entry
+	updated.Header = entry.Header.Clone()
+	for name, values := range resp.Header {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", "Content-Range":
+			continue
+		}
+		updated.Header[name] = values
+	}
+	updated.RequestTime = requestTime
+	updated.ResponseTime = time.Now()
+	cache.put(&updated, req)
+
+	return cache.serve(req, &updated, time.Now()), nil
+}
+
+// Revalidate a stale response without blocking the client
+func (cache *ResponseCache) revalidateBackground(req *http.Request, key string, entry *cacheEntry, fetch fetchFunc) {
+	call, leader := cache.acquire(key)
+	if !leader {
+		return
+	}
+	defer cache.release(key, call)
+
+	req.Header.Del("Cache-Control")
+	resp, err := cache.revalidate(req, key, entry, fetch)
+	if err != nil {
+		log.Warn("Cache revalidation failed: ", err)
+		return
+	}
+
+	// Read the body to let it get stored
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// Invalidate stored responses after an unsafe request
+func (cache *ResponseCache) invalidate(req *http.Request, key string, resp *http.Response) {
+	cache.PurgeURL(key)
+
+	// Invalidate Location and Content-Location targets on the same host
+	for _, name := range []string{"Location", "Content-Location"} {
+		target := resp.Header.Get(name)
+		if len(target) == 0 {
+			continue
+		}
+
+		u, err := req.URL.Parse(target)
+		if err != nil || (len(u.Host) > 0 && !strings.EqualFold(u.Host, req.Host)) {
+			continue
+		}
+		cache.PurgeURL(cacheKey(req.Host, u.RequestURI()))
+	}
+}
+
+// Return the cache key for a requested host and URI
+func cacheKey(host, requestURI string) string {
+	return strings.ToLower(host) + requestURI
+}
+
+// cacheTeeBody copies a response body into a buffer while it gets read
+type cacheTeeBody struct {
+	body       io.ReadCloser
+	buffer     bytes.Buffer
+	limit      int64
+	exceeded   bool
+	finished   bool
+	onComplete func(body []byte)
+	onDone     func()
+}
+
+func (tee *cacheTeeBody) Read(p []byte) (int, error) {
+	n, err := tee.body.Read(p)
+	if n > 0 && !tee.exceeded {
+		if int64(tee.buffer.Len()+n) > tee.limit {
+			tee.exceeded = true
+			tee.buffer.Reset()
+		} else {
+			tee.buffer.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF {
+		tee.finish(true)
+	}
+	return n, err
+}
+
+func (tee *cacheTeeBody) Close() error {
+	tee.finish(false)
+	return tee.body.Close()
+}
+
+func (tee *cacheTeeBody) finish(complete bool) {
+	if tee.finished {
+		return
+	}
+	tee.finished = true
+
+	if complete && !tee.exceeded {
+		tee.onComplete(tee.buffer.Bytes())
+	}
+	tee.onDone()
+}
@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var requests int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Background revalidations need the request context for the variables
+		if len(r.Header.Get("X-Id")) == 0 {
+			http.Error(w, "missing request id", http.StatusBadRequest)
+			return
+		}
+
+		n := atomic.AddInt64(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		fmt.Fprintf(w, "version %d", n)
+	}))
+	defer upstream.Close()
+
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations: []models.RouteLocation{{
+			Location:    "/",
+			Destination: upstream.URL + "/",
+			Cache:       &models.CacheConfig{},
+			Headers:     &models.HeaderRules{RequestSet: map[string]string{"X-Id": "$request_id"}},
+		}},
+	})
+	url := "http://" + server.Server[0].ListenAddress.Address + "/page"
+
+	get := func() string {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if body := get(); body != "version 1" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	// The stale response is served while it gets revalidated in background
+	if body := get(); body != "version 1" {
+		t.Fatalf("expected the stale response, got %q", body)
+	}
+	for i := 0; atomic.LoadInt64(&requests) < 2; i++ {
+		if i == 100 {
+			t.Fatal("stale response wasn't revalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Wait for the revalidated response to be stored
+	for i := 0; ; i++ {
+		if body := get(); body == "version 2" {
+			break
+		}
+		if i == 100 {
+			t.Fatal("revalidated response wasn't stored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCacheDiskVaryChange(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewResponseCache(&models.CacheConfig{Directory: dir})
+
+	req := httptest.NewRequest(http.MethodGet, "http://x/page", nil)
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	put := func(vary string) {
+		cache.put(&cacheEntry{
+			Key:          "x/page",
+			Vary:         []string{vary},
+			StatusCode:   http.StatusOK,
+			Header:       http.Header{"Vary": {vary}},
+			Body:         []byte("body"),
+			RequestTime:  time.Now(),
+			ResponseTime: time.Now(),
+		}, req)
+	}
+
+	put("Accept-Language")
+	put("Accept-Encoding")
+
+	// The variant of the old Vary header is gone from the disk too
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file in the cache directory, got %v", files)
+	}
+
+	// And doesn't come back after a restart
+	os.WriteFile(filepath.Join(dir, "unfinished.tmp"), []byte("x"), 0600)
+	cache = NewResponseCache(&models.CacheConfig{Directory: dir})
+	if entry := cache.get("x/page", req); entry == nil || entry.Vary[0] != "Accept-Encoding" {
+		t.Fatalf("expected the Accept-Encoding variant, got %v", entry)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(files) > 0 {
+		t.Fatalf("temporary files weren't removed: %v", files)
+	}
+}
+
+// Serve a cacheable response varying on Accept-Language. Returns the server
+// and a counter of requests
+func newCacheableUpstream(t *testing.T) (*httptest.Server, *int64) {
+	var requests int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "language "+r.Header.Get("Accept-Language"))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, &requests
+}
+
+func TestCacheVaryModifiedHeader(t *testing.T) {
+	upstream, requests := newCacheableUpstream(t)
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations: []models.RouteLocation{{
+			Location:    "/",
+			Destination: upstream.URL + "/",
+			Cache:       &models.CacheConfig{},
+			Headers:     &models.HeaderRules{RequestSet: map[string]string{"Accept-Language": "en"}},
+		}},
+	})
+
+	// The variant key uses the header sent by the client, not the modified one
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+server.Server[0].ListenAddress.Address+"/page", nil)
+		req.Header.Set("Accept-Language", "de")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "language en" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+
+	if n := atomic.LoadInt64(requests); n != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", n)
+	}
+}
+
+func TestCacheConditionalMiss(t *testing.T) {
+	upstream, requests := newCacheableUpstream(t)
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations:   []models.RouteLocation{{Location: "/", Destination: upstream.URL + "/", Cache: &models.CacheConfig{}}},
+	})
+	url := "http://" + server.Server[0].ListenAddress.Address + "/page"
+
+	// A client which has the response already gets a 304
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", resp.StatusCode)
+	}
+
+	// The full response was stored anyway
+	resp, err = http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "language " {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+	}
+	if n := atomic.LoadInt64(requests); n != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", n)
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Return the client certificate config of a location. Falls back to the config of the route
+func clientCertConfig(location *models.RouteLocation) *models.ClientCertConfig {
+	if location.ClientCert != nil {
+		return location.ClientCert
+	}
+	if location.Route != nil {
+		return location.Route.ClientCert
+	}
+	return nil
+}
+
+// Load the CA bundles of all client certificate configs
+func (server *ReverseProxyServer) initClientCAs() {
+	server.ClientCAs = make(map[*models.ClientCertConfig]*x509.CertPool)
+
+	load := func(config *models.ClientCertConfig) {
+		if config == nil {
+			return
+		}
+
+		pool, err := config.LoadCAs()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		server.ClientCAs[config] = pool
+	}
+
+	for i := range server.Routes {
+		load(server.Routes[i].ClientCert)
+		for j := range server.Routes[i].Locations {
+			load(server.Routes[i].Locations[j].ClientCert)
+		}
+	}
+}
+
+// Create a TLS config for each server name of the routes requiring client
+// certificates and select them by the SNI of the client. Clients without SNI
+// use the config of the IP they connected to
+func (server *ReverseProxyServer) clientCertTLSConfigs(base *tls.Config, routes []*models.Route) {
+	configs := make(map[string]*tls.Config)
+
+	for _, route := range routes {
+		var configsOfRoute []*models.ClientCertConfig
+		if route.ClientCert != nil {
+			configsOfRoute = append(configsOfRoute, route.ClientCert)
+		}
+		for i := range route.Locations {
+			if route.Locations[i].ClientCert != nil {
+				configsOfRoute = append(configsOfRoute, route.Locations[i].ClientCert)
+			}
+		}
+
+		if len(configsOfRoute) == 0 {
+			continue
+		}
+
+		tlsConfig := base.Clone()
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		for _, config := range configsOfRoute {
+			if err := config.AppendCAs(tlsConfig.ClientCAs); err != nil {
+				log.Fatalln(err)
+			}
+		}
+
+		// Locations decide on their own if the certificate is required
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if len(configsOfRoute) == 1 && route.ClientCert != nil && route.ClientCert.GetVerify() == models.ClientCertRequire {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		for _, name := range route.ServerNames {
+			configs[strings.ToLower(name)] = tlsConfig
+		}
+	}
+
+	if len(configs) == 0 {
+		return
+	}
+
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		var localAddr net.Addr
+		if hello.Conn != nil {
+			localAddr = hello.Conn.LocalAddr()
+		}
+		if config, ok := configs[tlsServerName(hello.ServerName, localAddr)]; ok {
+			return config, nil
+		}
+		return nil, nil
+	}
+}
+
+// Verify the client certificate of a request and pass its identity to the
+// upstream. Returns false if the request was denied
+func (httpServer *HTTPServer) checkClientCert(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) bool {
+	config := clientCertConfig(location)
+	if config == nil {
+		return true
+	}
+
+	// The certificate was verified using the TLS config of the server name sent
+	// in the handshake. Requests for another host of the connection have to use
+	// their own connection
+	if req.TLS != nil && location.Route != nil {
+		localAddr, _ := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		if !matchesServerName(location.Route, tlsServerName(req.TLS.ServerName, localAddr)) {
+			log.Debugf("TLS server name '%s' doesn't match host '%s'", req.TLS.ServerName, req.Host)
+			http.Error(w, "421 Misdirected Request", http.StatusMisdirectedRequest)
+			return false
+		}
+	}
+
+	prefix := config.GetHeaderPrefix()
+	for _, suffix := range []string{"", "-Verify", "-Subject", "-San", "-Fingerprint"} {
+		req.Header.Del(prefix + suffix)
+	}
+
+	var cert *x509.Certificate
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		cert = req.TLS.PeerCertificates[0]
+
+		// The TLS config might contain CAs of other locations
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range req.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(intermediate)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         httpServer.ClientCAs[config],
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			log.Debugf("Invalid client certificate from %s: %s", req.RemoteAddr, err)
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return false
+		}
+	}
+
+	if cert == nil {
+		if config.GetVerify() == models.ClientCertRequire {
+			log.Debugf("Missing client certificate from %s", req.RemoteAddr)
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return false
+		}
+
+		req.Header.Set(prefix+"-Verify", "NONE")
+		return true
+	}
+
+	if !config.MatchIdentity(cert) {
+		log.Debugf("Client certificate '%s' is not allowed", cert.Subject)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	sans := models.CertificateSANs(cert)
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	req.Header.Set(prefix+"-Verify", "SUCCESS")
+	req.Header.Set(prefix+"-Subject", cert.Subject.String())
+	if len(sans) > 0 {
+		req.Header.Set(prefix+"-San", strings.Join(sans, ","))
+	}
+	req.Header.Set(prefix+"-Fingerprint", hex.EncodeToString(fingerprint[:]))
+	if config.ForwardPEM {
+		req.Header.Set(prefix, url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))))
+	}
+
+	return true
+}
+
+// Return true if name is one of the server names of route
+func matchesServerName(route *models.Route, name string) bool {
+	for _, serverName := range route.ServerNames {
+		if strings.EqualFold(serverName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the lowercase server name sent by a client. Clients connecting to an
+// IP don't send one, the IP of localAddr is used instead
+func tlsServerName(serverName string, localAddr net.Addr) string {
+	if len(serverName) > 0 || localAddr == nil {
+		return strings.ToLower(serverName)
+	}
+
+	host, _, err := net.SplitHostPort(localAddr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
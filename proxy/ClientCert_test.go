@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Create a self signed client certificate and a CA file trusting it
+func testClientCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+func TestClientCertMisdirected(t *testing.T) {
+	route := &models.Route{ServerNames: []string{"secure.example.com"}}
+	route.Locations = []models.RouteLocation{{
+		Location:    "/",
+		Destination: "http://127.0.0.1:8080/",
+		ClientCert:  &models.ClientCertConfig{Verify: models.ClientCertOptional},
+	}}
+	route.Locations[0].Init(route)
+	httpServer := &HTTPServer{SSL: true}
+
+	tests := []struct {
+		serverName string
+		allowed    bool
+	}{
+		{"secure.example.com", true},
+		{"Secure.Example.com", true},
+		{"public.example.com", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "https://secure.example.com/", nil)
+		req.TLS = &tls.ConnectionState{ServerName: test.serverName}
+
+		rec := httptest.NewRecorder()
+		allowed := httpServer.checkClientCert(rec, req, &route.Locations[0])
+		if allowed != test.allowed {
+			t.Errorf("%q: expected allowed=%v, got %v", test.serverName, test.allowed, allowed)
+		}
+		if !allowed && rec.Code != http.StatusMisdirectedRequest {
+			t.Errorf("%q: expected 421, got %d", test.serverName, rec.Code)
+		}
+		if allowed && req.Header.Get("X-Client-Cert-Verify") != "NONE" {
+			t.Errorf("%q: expected verify header NONE, got %q", test.serverName, req.Header.Get("X-Client-Cert-Verify"))
+		}
+	}
+
+	// Clients connecting to an IP don't send a server name
+	route.ServerNames = []string{"127.0.0.1"}
+	for localIP, allowed := range map[string]bool{"127.0.0.1": true, "127.0.0.2": false} {
+		req := httptest.NewRequest(http.MethodGet, "https://127.0.0.1/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.ParseIP(localIP), Port: 443}))
+		req.TLS = &tls.ConnectionState{}
+
+		if httpServer.checkClientCert(httptest.NewRecorder(), req, &route.Locations[0]) != allowed {
+			t.Errorf("connection to %s without SNI: expected allowed=%v", localIP, allowed)
+		}
+	}
+}
+
+func TestClientCertWithoutSNI(t *testing.T) {
+	clientCert, caFile := testClientCertificate(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Client-Cert-Subject"))
+	}))
+	defer upstream.Close()
+
+	server := startTestServer(t, models.ListenAddress{SSL: true}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		ClientCert:  &models.ClientCertConfig{CAFile: caFile, Verify: models.ClientCertRequire},
+		Locations:   []models.RouteLocation{{Location: "/", Destination: upstream.URL + "/"}},
+	})
+
+	// Clients don't send SNI for IPs, the config of the IP is used
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: testCertPool(&server.Server[0]), Certificates: []tls.Certificate{clientCert}},
+	}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://" + server.Server[0].ListenAddress.Address + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "CN=client" {
+		t.Fatalf("expected the client certificate to be verified, got %d '%s'", resp.StatusCode, body)
+	}
+}
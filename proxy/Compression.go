@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+// Create a compressing writer for encoding
+func newCompressor(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case "br":
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+	case "zstd":
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	default:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	}
+}
+
+// Pick the encoding to use for the given Accept-Encoding header. Returns an empty
+// string if the client doesn't accept any of the encodings
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	if len(acceptEncoding) == 0 {
+		return ""
+	}
+
+	// Parse q-values
+	accepted := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		accepted[name] = q
+	}
+
+	// Take the first encoding with the highest q-value
+	var best string
+	var bestQ float64
+	for _, encoding := range encodings {
+		q, ok := accepted[encoding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// Return true if contentType matches one of the patterns
+func matchContentType(contentType string, patterns []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		if pattern == mediaType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add a value to a comma separated header if not already present
+func addHeaderToken(header http.Header, name, token string) {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if strings.EqualFold(item, token) || item == "*" {
+				return
+			}
+		}
+	}
+	header.Add(name, token)
+}
+
+// Compress a response if the client and the config allow it
+func compressResponse(req *http.Request, resp *http.Response, config *models.CompressionConfig) *http.Response {
+	if req.Method == http.MethodHead || resp.StatusCode < 200 ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusPartialContent {
+		return resp
+	}
+
+	// Don't compress already encoded, partial or incompressible content
+	if encoding := resp.Header.Get("Content-Encoding"); len(encoding) > 0 && !strings.EqualFold(encoding, "identity") {
+		return resp
+	}
+	if len(resp.Header.Get("Content-Range")) > 0 || !matchContentType(resp.Header.Get("Content-Type"), config.GetContentTypes()) {
+		return resp
+	}
+	if parseCacheControl(resp.Header).has("no-transform") {
+		return resp
+	}
+
+	// The response depends on the Accept-Encoding header from now on
+	addHeaderToken(resp.Header, "Vary", "Accept-Encoding")
+
+	if resp.ContentLength >= 0 && resp.ContentLength < config.GetMinSize() {
+		return resp
+	}
+
+	encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"), config.GetEncodings())
+	if len(encoding) == 0 {
+		return resp
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	compressor, err := newCompressor(encoding, pipeWriter)
+	if err != nil {
+		log.Error(err)
+		return resp
+	}
+
+	// Compress the body while it gets read
+	body := resp.Body
+	go func() {
+		_, err := io.Copy(compressor, body)
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+		body.Close()
+		pipeWriter.CloseWithError(err)
+	}()
+
+	resp.Body = &compressedBody{PipeReader: pipeReader, body: body}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Encoding", encoding)
+
+	// Ranges of the compressed stream can't be served
+	resp.Header.Del("Accept-Ranges")
+
+	// The compressed representation is not byte equal anymore
+	if etag := resp.Header.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+
+	return resp
+}
+
+// compressedBody body of a compressed response
+type compressedBody struct {
+	*io.PipeReader
+	body io.ReadCloser
+}
+
+// Close closes the pipe and the original body
+func (body *compressedBody) Close() error {
+	body.PipeReader.Close()
+	return body.body.Close()
+}
+
+// Replace a gzip encoded request body by its decompressed content
+func decompressRequest(req *http.Request) error {
+	if req.Body == nil || !strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+
+	reader, err := gzip.NewReader(req.Body)
+	if err != nil {
+		return err
+	}
+
+	req.Body = &decompressedBody{Reader: reader, body: req.Body}
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Encoding")
+	return nil
+}
+
+// decompressedBody body of a decompressed request
+type decompressedBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close closes the gzip reader and the original body
+func (body *decompressedBody) Close() error {
+	body.Reader.Close()
+	return body.body.Close()
+}
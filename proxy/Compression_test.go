@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/JojiiOfficial/ReverseProxy/models/units"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Create a response with body and headers
+func newTestResponse(body string, header http.Header) *http.Response {
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+// Decode the body of resp using its Content-Encoding
+func decodeBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	var reader io.Reader
+	var err error
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		reader, err = gzip.NewReader(resp.Body)
+	case "br":
+		reader = brotli.NewReader(resp.Body)
+	case "zstd":
+		reader, err = zstd.NewReader(resp.Body)
+	default:
+		reader = resp.Body
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"GZIP, zstd", "zstd"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0, gzip;q=0.1", "gzip"},
+		{"br;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.1, gzip;q=0.5", "gzip"},
+	}
+
+	for _, test := range tests {
+		if encoding := negotiateEncoding(test.acceptEncoding, models.SupportedEncodings); encoding != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.acceptEncoding, test.expected, encoding)
+		}
+	}
+}
+
+func TestCompressResponse(t *testing.T) {
+	body := strings.Repeat("compress me ", 200)
+	config := &models.CompressionConfig{}
+
+	for _, encoding := range models.SupportedEncodings {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		resp := compressResponse(req, newTestResponse(body, http.Header{
+			"Etag":          {`"v1"`},
+			"Accept-Ranges": {"bytes"},
+			"Vary":          {"Origin"},
+		}), config)
+
+		if resp.Header.Get("Content-Encoding") != encoding || resp.ContentLength != -1 {
+			t.Fatalf("%s: expected a compressed response, got %v", encoding, resp.Header)
+		}
+		if resp.Header.Get("ETag") != `W/"v1"` {
+			t.Errorf("%s: expected a weak ETag, got %s", encoding, resp.Header.Get("ETag"))
+		}
+		if len(resp.Header.Get("Accept-Ranges")) > 0 {
+			t.Errorf("%s: expected Accept-Ranges to be removed", encoding)
+		}
+		if vary := resp.Header.Values("Vary"); len(vary) != 2 || vary[1] != "Accept-Encoding" {
+			t.Errorf("%s: expected Vary to contain Accept-Encoding, got %v", encoding, vary)
+		}
+		if decoded := decodeBody(t, resp); decoded != body {
+			t.Errorf("%s: body doesn't match", encoding)
+		}
+	}
+
+	// Weak ETags are kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := compressResponse(req, newTestResponse(body, http.Header{"Etag": {`W/"v1"`}}), config)
+	if resp.Header.Get("ETag") != `W/"v1"` {
+		t.Errorf("expected the weak ETag to be kept, got %s", resp.Header.Get("ETag"))
+	}
+}
+
+func TestCompressResponseSkipped(t *testing.T) {
+	body := strings.Repeat("compress me ", 200)
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		body   string
+		config models.CompressionConfig
+		vary   bool
+	}{
+		{"head", http.MethodHead, http.Header{}, body, models.CompressionConfig{}, false},
+		{"encoded", http.MethodGet, http.Header{"Content-Encoding": {"br"}}, body, models.CompressionConfig{}, false},
+		{"range", http.MethodGet, http.Header{"Content-Range": {"bytes 0-9/100"}}, body, models.CompressionConfig{}, false},
+		{"content type", http.MethodGet, http.Header{"Content-Type": {"image/png"}}, body, models.CompressionConfig{}, false},
+		{"no-transform", http.MethodGet, http.Header{"Cache-Control": {"public, no-transform"}}, body, models.CompressionConfig{}, false},
+		{"min size", http.MethodGet, http.Header{}, "small", models.CompressionConfig{}, true},
+		{"configured min size", http.MethodGet, http.Header{}, body, models.CompressionConfig{MinSize: 10 * units.Kilobyte}, true},
+		{"encodings", http.MethodGet, http.Header{}, body, models.CompressionConfig{Encodings: []string{"br"}}, true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := compressResponse(req, newTestResponse(test.body, test.header), &test.config)
+
+		if resp.ContentLength != int64(len(test.body)) || resp.Header.Get("Content-Encoding") == "gzip" {
+			t.Errorf("%s: expected an uncompressed response, got %v", test.name, resp.Header)
+		}
+		if hasVary := resp.Header.Get("Vary") == "Accept-Encoding"; hasVary != test.vary {
+			t.Errorf("%s: expected Vary %v, got %v", test.name, test.vary, resp.Header.Values("Vary"))
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	body := strings.Repeat("compress me ", 200)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Echo decompressed request bodies
+		if r.Method == http.MethodPost {
+			if len(r.Header.Get("Content-Encoding")) > 0 {
+				http.Error(w, "still encoded", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			io.Copy(w, r.Body)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Accept-Ranges", "bytes")
+		io.WriteString(w, body)
+	}))
+	defer upstream.Close()
+
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations: []models.RouteLocation{{
+			Location:    "/",
+			Destination: upstream.URL + "/",
+			Compression: &models.CompressionConfig{Encodings: []string{"gzip"}, DecompressRequests: true},
+		}},
+	})
+	address := "http://" + server.Server[0].ListenAddress.Address + "/"
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	defer client.CloseIdleConnections()
+
+	req, _ := http.NewRequest(http.MethodGet, address, nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" || len(resp.Header.Get("Accept-Ranges")) > 0 {
+		t.Fatalf("unexpected headers %v", resp.Header)
+	}
+	if decoded := decodeBody(t, resp); decoded != body {
+		t.Fatal("body doesn't match")
+	}
+
+	// gzip request bodies are decompressed
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	io.WriteString(writer, "request body")
+	writer.Close()
+
+	req, _ = http.NewRequest(http.MethodPost, address, &compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != "request body" {
+		t.Fatalf("unexpected response %d '%s'", resp.StatusCode, data)
+	}
+}
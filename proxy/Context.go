@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+type contextKey int
+
+const requestContextKey contextKey = 0
+
+// requestContext data of an incoming request shared by the handlers
+type requestContext struct {
+	Location *models.RouteLocation
+	// URL requested by the client including scheme and host
+	PublicURL *url.URL
+	RequestID string
+	StartTime time.Time
+	// Name of the authenticated user
+	User string
+}
+
+// Attach a requestContext to a request
+func withRequestContext(req *http.Request, rc *requestContext) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), requestContextKey, rc))
+}
+
+// Get the requestContext of a request. Returns an empty context if not set
+func getRequestContext(req *http.Request) *requestContext {
+	if rc, ok := req.Context().Value(requestContextKey).(*requestContext); ok {
+		return rc
+	}
+	return &requestContext{}
+}
+
+// Return the request ID sent by the client or create a new one
+func getRequestID(req *http.Request) string {
+	if id := req.Header.Get("X-Request-Id"); len(id) > 0 && len(id) <= 128 && isPrintable(id) {
+		return id
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// FastCGI record types
+const (
+	fcgiBeginRequest = 1
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiStderr       = 7
+)
+
+// Each connection is used for a single request
+const (
+	fcgiVersion    = 1
+	fcgiResponder  = 1
+	fcgiRequestID  = 1
+	fcgiMaxContent = 65535
+)
+
+// Forward a request to a FastCGI application. The body of the request and
+// response are streamed
+func forwardFastCGI(req *http.Request, location *models.RouteLocation) (*http.Response, error) {
+	config := location.FastCGI
+
+	network, address := "tcp", location.DestinationURL.Host
+	if location.DestinationURL.Scheme == models.FastCGIUnixScheme {
+		network, address = "unix", location.DestinationURL.Path
+	}
+
+	dialer := net.Dialer{Timeout: config.GetConnectTimeout()}
+	conn, err := dialer.DialContext(req.Context(), network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort the request if the client is gone
+	stop := context.AfterFunc(req.Context(), func() {
+		conn.Close()
+	})
+
+	writer := bufio.NewWriter(conn)
+	writeFastCGIRecord(writer, fcgiBeginRequest, []byte{0, fcgiResponder, 0, 0, 0, 0, 0, 0})
+	writeFastCGIStream(writer, fcgiParams, encodeFastCGIParams(fastCGIParams(req, location)))
+	if err := writer.Flush(); err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+
+	// Send the body while the response is read
+	go func() {
+		if req.Body != nil {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := req.Body.Read(buf)
+				if n > 0 {
+					writeFastCGIRecord(writer, fcgiStdin, buf[:n])
+					if writer.Flush() != nil {
+						return
+					}
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+
+		writeFastCGIRecord(writer, fcgiStdin, nil)
+		writer.Flush()
+	}()
+
+	reader := bufio.NewReader(&fastCGIReader{reader: bufio.NewReader(conn), address: address})
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+
+	// Build the response from the CGI headers
+	status := http.StatusOK
+	if value := header.Get("Status"); len(value) >= 3 {
+		if code, err := strconv.Atoi(value[:3]); err == nil {
+			status = code
+		}
+		header.Del("Status")
+	} else if len(header.Get("Location")) > 0 {
+		status = http.StatusFound
+	}
+
+	contentLength := int64(-1)
+	if value := header.Get("Content-Length"); len(value) > 0 {
+		if length, err := strconv.ParseInt(value, 10, 64); err == nil {
+			contentLength = length
+		}
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(header),
+		ContentLength: contentLength,
+		Body:          &fastCGIBody{Reader: reader, conn: conn, stop: stop},
+		Request:       req,
+	}, nil
+}
+
+// Build the CGI params of a request
+func fastCGIParams(req *http.Request, location *models.RouteLocation) map[string]string {
+	config := location.FastCGI
+
+	// Use the URL requested by the client, req might be modified already
+	u := req.URL
+	if publicURL := getRequestContext(req).PublicURL; publicURL != nil {
+		u = publicURL
+	}
+
+	// Split the path relative to the location into script and PATH_INFO
+	rel := path.Clean(location.RelativePath(u.Path))
+	if strings.HasSuffix(u.Path, "/") && rel != "/" {
+		rel += "/"
+	}
+	script, pathInfo := rel, ""
+	if match := config.GetSplitPath().FindStringSubmatch(rel); match != nil {
+		script, pathInfo = match[1], match[2]
+	}
+	if strings.HasSuffix(script, "/") {
+		script += config.GetIndex()
+	}
+
+	prefix := ""
+	if raw := location.RelativePath(u.Path); strings.HasSuffix(u.Path, raw) {
+		prefix = strings.TrimSuffix(u.Path, raw)
+	}
+
+	scriptFilename := config.ScriptFilename
+	if len(scriptFilename) == 0 {
+		scriptFilename = filepath.Join(config.Root, filepath.FromSlash(script))
+	}
+
+	// Request headers first, so they can't override the params set below
+	params := make(map[string]string)
+	for name, values := range req.Header {
+		// The Proxy header would set HTTP_PROXY (httpoxy). Names containing
+		// underscores would collide with headers set by the proxy
+		if name == "Proxy" || name == "Content-Type" || name == "Content-Length" || strings.Contains(name, "_") {
+			continue
+		}
+		params["HTTP_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))] = strings.Join(values, ", ")
+	}
+
+	for name, value := range map[string]string{
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"SERVER_SOFTWARE":   "ReverseProxy",
+		"SERVER_PROTOCOL":   req.Proto,
+		"SERVER_NAME":       serverName(req, location),
+		"REQUEST_METHOD":    req.Method,
+		"REQUEST_SCHEME":    requestScheme(req),
+		"REQUEST_URI":       u.RequestURI(),
+		"DOCUMENT_URI":      u.Path,
+		"DOCUMENT_ROOT":     config.Root,
+		"QUERY_STRING":      u.RawQuery,
+		"SCRIPT_NAME":       prefix + script,
+		"SCRIPT_FILENAME":   scriptFilename,
+		"PATH_INFO":         pathInfo,
+		"REMOTE_ADDR":       stripPort(req.RemoteAddr),
+		"CONTENT_TYPE":      req.Header.Get("Content-Type"),
+		"HTTP_HOST":         req.Host,
+		// Required by PHP if cgi.force_redirect is enabled
+		"REDIRECT_STATUS": "200",
+	} {
+		params[name] = value
+	}
+
+	if len(pathInfo) > 0 {
+		params["PATH_TRANSLATED"] = filepath.Join(config.Root, filepath.FromSlash(pathInfo))
+	}
+	if _, port, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		params["REMOTE_PORT"] = port
+	}
+	if local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if host, port, err := net.SplitHostPort(local.String()); err == nil {
+			params["SERVER_ADDR"], params["SERVER_PORT"] = host, port
+		}
+	}
+	if req.ContentLength >= 0 {
+		params["CONTENT_LENGTH"] = strconv.FormatInt(req.ContentLength, 10)
+	}
+	if req.TLS != nil {
+		params["HTTPS"] = "on"
+	}
+
+	for name, value := range config.Params {
+		params[name] = expandVariables(value, req, location)
+	}
+
+	return params
+}
+
+// Encode params as FastCGI name-value pairs
+func encodeFastCGIParams(params map[string]string) []byte {
+	var buf []byte
+	for name, value := range params {
+		buf = appendFastCGILength(buf, len(name))
+		buf = appendFastCGILength(buf, len(value))
+		buf = append(buf, name...)
+		buf = append(buf, value...)
+	}
+	return buf
+}
+
+// Lengths above 127 bytes are encoded using 4 bytes
+func appendFastCGILength(buf []byte, length int) []byte {
+	if length < 128 {
+		return append(buf, byte(length))
+	}
+	return binary.BigEndian.AppendUint32(buf, uint32(length)|1<<31)
+}
+
+// Write content as stream of records, terminated by an empty one
+func writeFastCGIStream(writer *bufio.Writer, recordType byte, content []byte) {
+	for len(content) > 0 {
+		n := min(len(content), fcgiMaxContent)
+		writeFastCGIRecord(writer, recordType, content[:n])
+		content = content[n:]
+	}
+	writeFastCGIRecord(writer, recordType, nil)
+}
+
+// Write a single record. Errors are returned by Flush
+func writeFastCGIRecord(writer *bufio.Writer, recordType byte, content []byte) {
+	padding := -len(content) & 7
+
+	header := [8]byte{fcgiVersion, recordType}
+	binary.BigEndian.PutUint16(header[2:], fcgiRequestID)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+	header[6] = byte(padding)
+
+	writer.Write(header[:])
+	writer.Write(content)
+	writer.Write(make([]byte, padding))
+}
+
+// fastCGIReader reads the stdout stream of a FastCGI response. Logs the
+// stderr stream
+type fastCGIReader struct {
+	reader  *bufio.Reader
+	address string
+	content []byte
+	done    bool
+}
+
+// Read implements io.Reader
+func (reader *fastCGIReader) Read(p []byte) (int, error) {
+	for len(reader.content) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+
+		var header [8]byte
+		if _, err := io.ReadFull(reader.reader, header[:]); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+
+		content := make([]byte, int(binary.BigEndian.Uint16(header[4:]))+int(header[6]))
+		if _, err := io.ReadFull(reader.reader, content); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		content = content[:binary.BigEndian.Uint16(header[4:])]
+
+		switch header[1] {
+		case fcgiStdout:
+			reader.content = content
+		case fcgiStderr:
+			if len(content) > 0 {
+				log.Warnf("FastCGI '%s': %s", reader.address, strings.TrimSpace(string(content)))
+			}
+		case fcgiEndRequest:
+			reader.done = true
+		}
+	}
+
+	n := copy(p, reader.content)
+	reader.content = reader.content[n:]
+	return n, nil
+}
+
+// The application has to end the request explicitly
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// fastCGIBody closes the connection once the response was read
+type fastCGIBody struct {
+	io.Reader
+	conn net.Conn
+	stop func() bool
+}
+
+// Close implements io.Closer
+func (body *fastCGIBody) Close() error {
+	body.stop()
+	return body.conn.Close()
+}
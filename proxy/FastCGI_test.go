@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Serve handler as FastCGI application. Returns the address it listens on
+func startFastCGIApp(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go fcgi.Serve(listener, handler)
+	return listener.Addr().String()
+}
+
+func fastCGITestLocation(config models.FastCGIConfig) *models.RouteLocation {
+	route := &models.Route{ServerNames: []string{"x"}}
+	route.Locations = []models.RouteLocation{{Location: "/app/", Destination: "fcgi://127.0.0.1:9000", FastCGI: &config}}
+	route.Locations[0].Init(route)
+	return &route.Locations[0]
+}
+
+func TestFastCGIParams(t *testing.T) {
+	location := fastCGITestLocation(models.FastCGIConfig{
+		Root:   "/srv/www",
+		Params: map[string]string{"APP_ENV": "production"},
+	})
+
+	tests := []struct {
+		target, scriptName, scriptFilename, pathInfo string
+	}{
+		{"/app/index.php", "/app/index.php", "/srv/www/index.php", ""},
+		{"/app/blog/post.php/2024/title?page=2", "/app/blog/post.php", "/srv/www/blog/post.php", "/2024/title"},
+		{"/app/docs/", "/app/docs/index.php", "/srv/www/docs/index.php", ""},
+		{"/app/", "/app/index.php", "/srv/www/index.php", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://x"+test.target, nil)
+		publicURL := *req.URL
+		req = withRequestContext(req, &requestContext{Location: location, PublicURL: &publicURL})
+
+		params := fastCGIParams(req, location)
+		if params["SCRIPT_NAME"] != test.scriptName || params["SCRIPT_FILENAME"] != test.scriptFilename || params["PATH_INFO"] != test.pathInfo {
+			t.Errorf("%s: unexpected split %q %q %q", test.target, params["SCRIPT_NAME"], params["SCRIPT_FILENAME"], params["PATH_INFO"])
+		}
+		if params["REQUEST_URI"] != test.target || params["APP_ENV"] != "production" {
+			t.Errorf("%s: unexpected params %v", test.target, params)
+		}
+	}
+}
+
+func TestFastCGIParamsHeaders(t *testing.T) {
+	location := fastCGITestLocation(models.FastCGIConfig{Root: "/srv/www"})
+
+	req := httptest.NewRequest(http.MethodGet, "http://x/app/index.php", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header["X_Forwarded_For"] = []string{"10.6.6.6"}
+	req.Header.Set("Proxy", "http://evil")
+	req.Header["Script_Filename"] = []string{"/etc/passwd"}
+	publicURL := *req.URL
+	req = withRequestContext(req, &requestContext{Location: location, PublicURL: &publicURL})
+
+	params := fastCGIParams(req, location)
+	if params["HTTP_X_FORWARDED_FOR"] != "10.0.0.1" {
+		t.Errorf("header with underscores overrode a header, got %q", params["HTTP_X_FORWARDED_FOR"])
+	}
+	if _, ok := params["HTTP_PROXY"]; ok {
+		t.Error("Proxy header was passed")
+	}
+	if params["SCRIPT_FILENAME"] != "/srv/www/index.php" {
+		t.Errorf("header overrode SCRIPT_FILENAME, got %q", params["SCRIPT_FILENAME"])
+	}
+}
+
+func TestFastCGI(t *testing.T) {
+	address := startFastCGIApp(t, func(w http.ResponseWriter, r *http.Request) {
+		env := fcgi.ProcessEnv(r)
+		w.Header().Set("X-Script", env["SCRIPT_FILENAME"])
+		w.Header().Set("X-Document-URI", env["DOCUMENT_URI"])
+
+		if r.URL.Query().Get("teapot") == "1" {
+			w.WriteHeader(http.StatusTeapot)
+		}
+		io.WriteString(w, r.Method+" "+r.URL.RequestURI())
+	})
+
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations: []models.RouteLocation{{
+			Location:    "/",
+			Destination: "fcgi://" + address,
+			FastCGI:     &models.FastCGIConfig{Root: "/srv/www"},
+		}},
+	})
+	base := "http://" + server.Server[0].ListenAddress.Address
+
+	resp, err := http.Get(base + "/shop/cart.php/items?id=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "GET /shop/cart.php/items?id=3" {
+		t.Fatalf("unexpected response %d '%s'", resp.StatusCode, body)
+	}
+	if resp.Header.Get("X-Script") != "/srv/www/shop/cart.php" || resp.Header.Get("X-Document-URI") != "/shop/cart.php/items" {
+		t.Fatalf("unexpected params %q %q", resp.Header.Get("X-Script"), resp.Header.Get("X-Document-URI"))
+	}
+	if len(resp.Header.Get("Status")) > 0 {
+		t.Fatal("Status header was passed to the client")
+	}
+
+	// Directories use the index script
+	resp, err = http.Get(base + "/shop/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Script") != "/srv/www/shop/index.php" {
+		t.Fatalf("expected the index script, got %q", resp.Header.Get("X-Script"))
+	}
+
+	// The Status header sets the status code
+	resp, err = http.Get(base + "/index.php?teapot=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Fatalf("expected 418, got %d", resp.StatusCode)
+	}
+}
+
+func TestFastCGIStreaming(t *testing.T) {
+	received := make(chan string, 1)
+	release := make(chan struct{})
+
+	address := startFastCGIApp(t, func(w http.ResponseWriter, r *http.Request) {
+		// The first line arrives while the client is still sending
+		line, _ := bufio.NewReader(r.Body).ReadString('\n')
+		received <- line
+		io.Copy(io.Discard, r.Body)
+
+		// The first part of the response arrives before the rest is written
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+	})
+
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations: []models.RouteLocation{{
+			Location:    "/",
+			Destination: "fcgi://" + address,
+			FastCGI:     &models.FastCGIConfig{Root: "/srv/www"},
+		}},
+	})
+
+	bodyReader, bodyWriter := io.Pipe()
+	req, _ := http.NewRequest(http.MethodPost, "http://"+server.Server[0].ListenAddress.Address+"/upload.php", bodyReader)
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+		results <- result{resp, err}
+	}()
+
+	io.WriteString(bodyWriter, "ping\n")
+	select {
+	case line := <-received:
+		if line != "ping\n" {
+			t.Fatalf("expected ping, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request body wasn't streamed")
+	}
+	bodyWriter.Close()
+
+	res := <-results
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	defer res.resp.Body.Close()
+
+	reader := bufio.NewReader(res.resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "first\n" {
+		close(release)
+		t.Fatalf("response body wasn't streamed, got %q %v", line, err)
+	}
+	close(release)
+
+	if rest, _ := io.ReadAll(reader); string(rest) != "second\n" {
+		t.Fatalf("unexpected rest of the response %q", rest)
+	}
+}
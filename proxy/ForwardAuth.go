@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Max size of an auth response body which gets passed to the client
+const maxForwardAuthBody = 1 << 20
+
+// forwardAuthResult a successful auth response
+type forwardAuthResult struct {
+	header  http.Header
+	user    string
+	expires time.Time
+}
+
+// forwardAuthClient sends auth subrequests and caches their results
+type forwardAuthClient struct {
+	config *models.ForwardAuth
+	client *http.Client
+
+	mutex     sync.Mutex
+	results   map[string]*forwardAuthResult
+	lastClean time.Time
+}
+
+func newForwardAuthClient(config *models.ForwardAuth) *forwardAuthClient {
+	return &forwardAuthClient{
+		config: config,
+		client: &http.Client{
+			Timeout: config.GetTimeout(),
+			// Redirects are passed to the client
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		results: make(map[string]*forwardAuthResult),
+	}
+}
+
+// Return the cache key of a request. Contains all headers passed to the auth service
+func (forward *forwardAuthClient) cacheKey(req *http.Request) string {
+	hash := sha256.New()
+	io.WriteString(hash, req.Method+"\n"+req.Host+"\n"+req.URL.RequestURI())
+	for _, name := range forward.config.GetRequestHeaders() {
+		for _, value := range req.Header.Values(name) {
+			io.WriteString(hash, "\n"+name+":"+value)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (forward *forwardAuthClient) getCached(key string) *forwardAuthResult {
+	forward.mutex.Lock()
+	defer forward.mutex.Unlock()
+
+	result, ok := forward.results[key]
+	if !ok || time.Now().After(result.expires) {
+		return nil
+	}
+	return result
+}
+
+func (forward *forwardAuthClient) putCached(key string, result *forwardAuthResult) {
+	forward.mutex.Lock()
+	defer forward.mutex.Unlock()
+
+	// Remove expired results from time to time
+	now := time.Now()
+	if now.Sub(forward.lastClean) > time.Duration(forward.config.CacheTTL) {
+		for k, item := range forward.results {
+			if now.After(item.expires) {
+				delete(forward.results, k)
+			}
+		}
+		forward.lastClean = now
+	}
+
+	forward.results[key] = result
+}
+
+// Build the subrequest for the auth service. It uses the method of the
+// original request but never contains its body
+func (forward *forwardAuthClient) buildRequest(req *http.Request) (*http.Request, error) {
+	authReq, err := http.NewRequestWithContext(req.Context(), req.Method, forward.config.Address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range forward.config.GetRequestHeaders() {
+		for _, value := range req.Header.Values(name) {
+			authReq.Header.Add(name, value)
+		}
+	}
+
+	// Describe the original request
+	authReq.Header.Set("X-Forwarded-Method", req.Method)
+	authReq.Header.Set("X-Forwarded-Proto", requestScheme(req))
+	authReq.Header.Set("X-Forwarded-Host", req.Host)
+	authReq.Header.Set("X-Forwarded-Uri", req.URL.RequestURI())
+	authReq.Header.Set("X-Forwarded-For", clientIP(req, getRequestContext(req).Location))
+	authReq.Header.Set("X-Original-Method", req.Method)
+	authReq.Header.Set("X-Original-Url", getRequestContext(req).PublicURL.String())
+	if id := getRequestContext(req).RequestID; len(id) > 0 {
+		authReq.Header.Set("X-Request-Id", id)
+	}
+
+	return authReq, nil
+}
+
+// Ask the auth service if a request is allowed. Returns the username and true on
+// success. Otherwise the response has been written already
+func (forward *forwardAuthClient) authenticate(w http.ResponseWriter, req *http.Request) (string, bool) {
+	// Don't let clients set the headers of the auth service
+	for _, name := range forward.config.ResponseHeaders {
+		req.Header.Del(name)
+	}
+
+	var key string
+	if forward.config.CacheTTL > 0 {
+		key = forward.cacheKey(req)
+		if result := forward.getCached(key); result != nil {
+			forward.apply(req, result)
+			return result.user, true
+		}
+	}
+
+	authReq, err := forward.buildRequest(req)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return "", false
+	}
+
+	resp, err := forward.client.Do(authReq)
+	if err != nil {
+		log.Errorf("Forward auth request failed: %s", err)
+		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		result := &forwardAuthResult{
+			header: make(http.Header),
+		}
+		for _, name := range forward.config.ResponseHeaders {
+			for _, value := range resp.Header.Values(name) {
+				result.header.Add(name, value)
+			}
+		}
+		if len(forward.config.UserResponseHeader) > 0 {
+			result.user = resp.Header.Get(forward.config.UserResponseHeader)
+		}
+
+		// Cookies of the auth service, e.g. a refreshed session, are sent to the
+		// client. They don't get cached
+		for _, cookie := range resp.Header.Values("Set-Cookie") {
+			w.Header().Add("Set-Cookie", cookie)
+		}
+
+		if forward.config.CacheTTL > 0 {
+			result.expires = time.Now().Add(time.Duration(forward.config.CacheTTL))
+			forward.putCached(key, result)
+		}
+
+		forward.apply(req, result)
+		return result.user, true
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode >= 300 && resp.StatusCode < 400:
+		// Pass the response of the auth service to the client
+		for name, values := range resp.Header {
+			if name == "Content-Length" || name == "Connection" || name == "Transfer-Encoding" {
+				continue
+			}
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, io.LimitReader(resp.Body, maxForwardAuthBody))
+		return "", false
+	}
+
+	log.Errorf("Forward auth service responded with unexpected status %d", resp.StatusCode)
+	http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	return "", false
+}
+
+// Copy the headers of a successful auth response onto the upstream request
+func (forward *forwardAuthClient) apply(req *http.Request, result *forwardAuthResult) {
+	for name, values := range result.header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+}
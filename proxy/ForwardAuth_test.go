@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Answer auth subrequests depending on their Authorization header. Returns
+// the server and a counter of subrequests
+func newForwardAuthServer(t *testing.T) (*httptest.Server, *int64) {
+	t.Helper()
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.ContentLength > 0 || r.Method != r.Header.Get("X-Forwarded-Method") {
+			http.Error(w, "unexpected subrequest", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get("Authorization") {
+		case "alice":
+			w.Header().Set("X-User", "alice")
+			w.Header().Set("X-Groups", "admin")
+			w.Header().Set("X-Internal", "secret")
+			w.Header().Set("Set-Cookie", "session=refreshed; Path=/")
+		case "bob":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case "":
+			w.Header().Set("Location", "https://login.example.com/?rd="+r.Header.Get("X-Original-Url"))
+			w.WriteHeader(http.StatusFound)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="test"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+// Send req through the forward auth client. Returns the recorded response,
+// the request which would be sent upstream, the username and whether it was allowed
+func forwardAuthenticate(forward *forwardAuthClient, method, authorization string) (*httptest.ResponseRecorder, *http.Request, string, bool) {
+	req := httptest.NewRequest(method, "http://x/admin?page=1", strings.NewReader("body"))
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.Header.Set("X-User", "mallory")
+	publicURL := *req.URL
+	req = withRequestContext(req, &requestContext{PublicURL: &publicURL})
+
+	rec := httptest.NewRecorder()
+	user, ok := forward.authenticate(rec, req)
+	return rec, req, user, ok
+}
+
+func TestForwardAuth(t *testing.T) {
+	server, _ := newForwardAuthServer(t)
+	forward := newForwardAuthClient(&models.ForwardAuth{
+		Address:            server.URL,
+		ResponseHeaders:    []string{"X-User", "X-Groups"},
+		UserResponseHeader: "X-User",
+	})
+
+	// 2xx copies the configured headers and passes cookies to the client
+	rec, req, user, ok := forwardAuthenticate(forward, http.MethodPost, "alice")
+	if !ok || user != "alice" {
+		t.Fatalf("expected alice to be allowed, got %v %q (%d)", ok, user, rec.Code)
+	}
+	if req.Header.Get("X-User") != "alice" || req.Header.Get("X-Groups") != "admin" || len(req.Header.Get("X-Internal")) > 0 {
+		t.Fatalf("unexpected upstream headers %v", req.Header)
+	}
+	if rec.Header().Get("Set-Cookie") != "session=refreshed; Path=/" {
+		t.Fatalf("expected cookie for the client, got %q", rec.Header().Get("Set-Cookie"))
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != "body" {
+		t.Fatalf("request body was consumed, got %q", body)
+	}
+
+	// Denials and redirects are passed to the client
+	tests := []struct {
+		authorization string
+		status        int
+		header        string
+		value         string
+	}{
+		{"bob", http.StatusForbidden, "", ""},
+		{"eve", http.StatusUnauthorized, "WWW-Authenticate", `Bearer realm="test"`},
+		{"", http.StatusFound, "Location", "https://login.example.com/?rd=http://x/admin?page=1"},
+	}
+	for _, test := range tests {
+		rec, _, _, ok := forwardAuthenticate(forward, http.MethodGet, test.authorization)
+		if ok || rec.Code != test.status {
+			t.Errorf("%q: expected %d, got %v %d", test.authorization, test.status, ok, rec.Code)
+			continue
+		}
+		if len(test.header) > 0 && rec.Header().Get(test.header) != test.value {
+			t.Errorf("%q: expected %s %q, got %q", test.authorization, test.header, test.value, rec.Header().Get(test.header))
+		}
+	}
+}
+
+func TestForwardAuthCache(t *testing.T) {
+	server, requests := newForwardAuthServer(t)
+	forward := newForwardAuthClient(&models.ForwardAuth{
+		Address:         server.URL,
+		ResponseHeaders: []string{"X-User"},
+		CacheTTL:        models.ConfigDuration(time.Minute),
+	})
+
+	for i := 0; i < 3; i++ {
+		_, req, _, ok := forwardAuthenticate(forward, http.MethodGet, "alice")
+		if !ok || req.Header.Get("X-User") != "alice" {
+			t.Fatalf("expected cached result to be applied, got %v %q", ok, req.Header.Get("X-User"))
+		}
+	}
+	if n := atomic.LoadInt64(requests); n != 1 {
+		t.Fatalf("expected 1 subrequest, got %d", n)
+	}
+
+	// Denials aren't cached
+	for i := 0; i < 2; i++ {
+		forwardAuthenticate(forward, http.MethodGet, "bob")
+	}
+	if n := atomic.LoadInt64(requests); n != 3 {
+		t.Fatalf("expected 3 subrequests, got %d", n)
+	}
+
+	// Expired results are requested again
+	forward.mutex.Lock()
+	for _, result := range forward.results {
+		result.expires = time.Now().Add(-time.Second)
+	}
+	forward.mutex.Unlock()
+
+	forwardAuthenticate(forward, http.MethodGet, "alice")
+	if n := atomic.LoadInt64(requests); n != 4 {
+		t.Fatalf("expected 4 subrequests, got %d", n)
+	}
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// gRPC status codes used for errors of the proxy
+const (
+	grpcStatusInternal         = 13
+	grpcStatusUnknown          = 2
+	grpcStatusPermissionDenied = 7
+	grpcStatusUnimplemented    = 12
+	grpcStatusUnavailable      = 14
+	grpcStatusUnauthenticated  = 16
+)
+
+// Map a HTTP status to a gRPC status code like gRPC clients do
+func grpcStatusFromHTTP(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return grpcStatusInternal
+	case http.StatusUnauthorized:
+		return grpcStatusUnauthenticated
+	case http.StatusForbidden:
+		return grpcStatusPermissionDenied
+	case http.StatusNotFound:
+		return grpcStatusUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return grpcStatusUnavailable
+	}
+	return grpcStatusUnknown
+}
+
+// Turn the header of a HTTP error response into the header of a trailers-only
+// gRPC response
+func setGRPCErrorHeader(header http.Header, status int, contentType string) {
+	header.Del("Content-Length")
+	header.Del("X-Content-Type-Options")
+	header.Set("Content-Type", contentType)
+	header.Set("Grpc-Status", strconv.Itoa(grpcStatusFromHTTP(status)))
+	header.Set("Grpc-Message", strconv.Itoa(status)+" "+http.StatusText(status))
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Content types of gRPC-Web calls
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+)
+
+// Flag of the frame containing the trailers in gRPC-Web responses
+const grpcWebTrailerFlag = 0x80
+
+// Return true if req is a gRPC-Web call
+func isGRPCWebRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// Return the content type of gRPC responses matching req
+func grpcContentType(req *http.Request) string {
+	contentType := req.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, grpcWebTextContentType):
+		return grpcWebTextContentType
+	case strings.HasPrefix(contentType, grpcWebContentType):
+		return grpcWebContentType
+	case strings.HasPrefix(contentType, "application/grpc"):
+		return "application/grpc"
+	}
+	return ""
+}
+
+// Translate a gRPC-Web call into a gRPC call and its response back
+func forwardGRPCWeb(req *http.Request) (*http.Response, error) {
+	contentType := req.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, grpcWebTextContentType)
+
+	// application/grpc-web-text+proto -> application/grpc+proto
+	subtype := ""
+	if i := strings.IndexAny(contentType, "+;"); i >= 0 {
+		subtype = contentType[i:]
+	}
+	req.Header.Set("Content-Type", "application/grpc"+subtype)
+	req.Header.Set("Te", "trailers")
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+	if text && req.Body != nil {
+		req.Body = &grpcWebTextReader{ReadCloser: req.Body}
+	}
+
+	resp, err := upstreamTransport(req).RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	responseType := grpcWebContentType
+	if text {
+		responseType = grpcWebTextContentType
+	}
+	if upstreamType := resp.Header.Get("Content-Type"); strings.HasPrefix(upstreamType, "application/grpc") {
+		responseType += strings.TrimPrefix(upstreamType, "application/grpc")
+	}
+	resp.Header.Set("Content-Type", responseType)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+
+	// Send the trailers as last frame of the body. The transport fills
+	// resp.Trailer once the body was read
+	var body io.ReadCloser = &grpcWebTrailerReader{ReadCloser: resp.Body, resp: resp}
+	resp.Header.Del("Trailer")
+	resp.Trailer = nil
+	if text {
+		body = &grpcWebTextWriter{ReadCloser: body}
+	}
+	resp.Body = body
+
+	return resp, nil
+}
+
+// grpcWebTrailerReader appends the trailers of a gRPC response to its body
+type grpcWebTrailerReader struct {
+	io.ReadCloser
+	resp  *http.Response
+	frame *bytes.Reader
+}
+
+// Read implements io.Reader
+func (reader *grpcWebTrailerReader) Read(p []byte) (int, error) {
+	if reader.frame == nil {
+		n, err := reader.ReadCloser.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+
+		// The trailers are available after the body was read. Don't send
+		// them as HTTP trailers as well
+		reader.frame = bytes.NewReader(encodeGRPCWebTrailers(reader.resp.Trailer))
+		reader.resp.Trailer = nil
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	return reader.frame.Read(p)
+}
+
+// Encode trailers as gRPC-Web trailer frame
+func encodeGRPCWebTrailers(trailer http.Header) []byte {
+	if len(trailer) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(trailer))
+	for name := range trailer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var payload bytes.Buffer
+	for _, name := range names {
+		for _, value := range trailer[name] {
+			payload.WriteString(strings.ToLower(name) + ": " + value + "\r\n")
+		}
+	}
+
+	frame := make([]byte, 5, 5+payload.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(payload.Len()))
+	return append(frame, payload.Bytes()...)
+}
+
+// grpcWebTextReader decodes the base64 encoded body of gRPC-Web text calls.
+// Clients may send padding after each message
+type grpcWebTextReader struct {
+	io.ReadCloser
+	pending []byte
+	decoded []byte
+	err     error
+}
+
+// Read implements io.Reader
+func (reader *grpcWebTextReader) Read(p []byte) (int, error) {
+	for len(reader.decoded) == 0 {
+		if reader.err != nil {
+			if reader.err == io.EOF && len(reader.pending) > 0 {
+				return 0, base64.CorruptInputError(0)
+			}
+			return 0, reader.err
+		}
+
+		buf := make([]byte, 4096)
+		n, err := reader.ReadCloser.Read(buf)
+		reader.err = err
+		for _, c := range buf[:n] {
+			if c != '\r' && c != '\n' {
+				reader.pending = append(reader.pending, c)
+			}
+		}
+
+		// Decode complete quanta. Padding ends a base64 string
+		for complete := len(reader.pending) / 4 * 4; complete > 0; complete = len(reader.pending) / 4 * 4 {
+			end := complete
+			if i := bytes.IndexByte(reader.pending[:complete], '='); i >= 0 {
+				end = (i/4 + 1) * 4
+			}
+
+			decoded := make([]byte, base64.StdEncoding.DecodedLen(end))
+			n, err := base64.StdEncoding.Decode(decoded, reader.pending[:end])
+			if err != nil {
+				reader.err = err
+				break
+			}
+			reader.decoded = append(reader.decoded, decoded[:n]...)
+			reader.pending = reader.pending[end:]
+		}
+	}
+
+	n := copy(p, reader.decoded)
+	reader.decoded = reader.decoded[n:]
+	return n, nil
+}
+
+// grpcWebTextWriter base64 encodes the body of responses to gRPC-Web text
+// calls. Each chunk is encoded on its own, so messages can be streamed
+type grpcWebTextWriter struct {
+	io.ReadCloser
+	encoded []byte
+}
+
+// Read implements io.Reader
+func (writer *grpcWebTextWriter) Read(p []byte) (int, error) {
+	if len(writer.encoded) == 0 {
+		buf := make([]byte, 3072)
+		n, err := writer.ReadCloser.Read(buf)
+		if n == 0 {
+			return 0, err
+		}
+
+		writer.encoded = make([]byte, base64.StdEncoding.EncodedLen(n))
+		base64.StdEncoding.Encode(writer.encoded, buf[:n])
+	}
+
+	n := copy(p, writer.encoded)
+	writer.encoded = writer.encoded[n:]
+	return n, nil
+}
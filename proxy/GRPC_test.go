@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTTP/2 client connecting without TLS
+var h2cTestClient = &http.Client{
+	Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	},
+}
+
+// Encode message as length prefixed gRPC message
+func grpcFrame(message string) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// Answer gRPC calls with the request message and the request header
+// X-Checksum as response trailer
+func newGRPCUpstream(t *testing.T) *httptest.Server {
+	upstream := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc" {
+			http.Error(w, "expected a gRPC call", http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, X-Checksum")
+		w.Write(body)
+
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("X-Checksum", r.Header.Get("X-Checksum"))
+	}), &http2.Server{}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestGRPC(t *testing.T) {
+	upstream := newGRPCUpstream(t)
+	server := startTestServer(t, models.ListenAddress{H2C: true}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations: []models.RouteLocation{{
+			Location:    "/helloworld.Greeter",
+			Destination: "grpc://" + upstream.Listener.Addr().String() + "/helloworld.Greeter",
+		}},
+	})
+
+	message := grpcFrame("hello")
+	req, _ := http.NewRequest(http.MethodPost, "http://"+server.Server[0].ListenAddress.Address+"/helloworld.Greeter/SayHello", io.NopCloser(bytes.NewReader(message)))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("X-Checksum", "abc")
+
+	resp, err := h2cTestClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, message) {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("expected grpc-status 0 trailer, got %v", resp.Trailer)
+	}
+	if resp.Trailer.Get("X-Checksum") != "abc" {
+		t.Fatalf("expected X-Checksum trailer, got %v", resp.Trailer)
+	}
+}
+
+func TestH2CDisabled(t *testing.T) {
+	upstream := newGRPCUpstream(t)
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations:   []models.RouteLocation{{Location: "/", Destination: "grpc://" + upstream.Listener.Addr().String() + "/"}},
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "http://"+server.Server[0].ListenAddress.Address+"/helloworld.Greeter/SayHello", bytes.NewReader(grpcFrame("hello")))
+	req.Header.Set("Content-Type", "application/grpc")
+
+	if resp, err := h2cTestClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected HTTP/2 without TLS to fail on a listener without H2C")
+	}
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"golang.org/x/net/http2"
+)
+
+// Transport for HTTP/2 upstreams without TLS
+var h2cTransport = &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	},
+}
+
+// Transport for HTTP/2 upstreams using TLS
+var h2Transport = &http2.Transport{}
+
+// Return the transport for the destination scheme of req. HTTP/2 schemes
+// get replaced by http or https
+func upstreamTransport(req *http.Request) http.RoundTripper {
+	switch req.URL.Scheme {
+	case models.H2CScheme, models.GRPCScheme:
+		req.URL.Scheme = "http"
+		return h2cTransport
+	case models.GRPCSScheme:
+		req.URL.Scheme = "https"
+		return h2Transport
+	}
+
+	return http.DefaultTransport
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Create the HTTP/3 server of an SSL address. It uses the certificates and
+// limits of the TCP server
+func (httpServer *HTTPServer) initHTTP3() {
+	httpServer.HTTP3 = &http3.Server{
+		Addr:           httpServer.Server.Addr,
+		Handler:        httpServer,
+		TLSConfig:      httpServer.Server.TLSConfig,
+		MaxHeaderBytes: httpServer.Server.MaxHeaderBytes,
+		IdleTimeout:    httpServer.Server.IdleTimeout,
+	}
+}
+
+// Apply the read and write timeouts of the TCP server to HTTP/3 requests.
+// Advertise HTTP/3 to clients using TCP
+func (httpServer *HTTPServer) handleHTTP3(w http.ResponseWriter, req *http.Request, start time.Time) {
+	if req.ProtoMajor != 3 {
+		httpServer.HTTP3.SetQUICHeaders(w.Header())
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	if timeout := httpServer.Server.ReadTimeout; timeout > 0 {
+		controller.SetReadDeadline(start.Add(timeout))
+	}
+	if timeout := httpServer.Server.WriteTimeout; timeout > 0 {
+		controller.SetWriteDeadline(start.Add(timeout))
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello "+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	server := startTestServer(t, models.ListenAddress{SSL: true, HTTP3: true}, &models.Route{
+		ServerNames: []string{"localhost"},
+		Locations:   []models.RouteLocation{{Location: "/", Destination: upstream.URL + "/"}},
+	})
+	httpServer := &server.Server[0]
+	if httpServer.HTTP3 == nil {
+		t.Fatal("HTTP/3 server wasn't created")
+	}
+	url := "https://localhost:" + httpServer.ListenAddress.GetPort() + "/h3"
+	tlsConfig := &tls.Config{RootCAs: testCertPool(httpServer)}
+
+	// Clients using TCP are told about HTTP/3
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Alt-Svc") != `h3=":`+httpServer.ListenAddress.GetPort()+`"; ma=2592000` {
+		t.Fatalf("unexpected Alt-Svc header '%s'", resp.Header.Get("Alt-Svc"))
+	}
+
+	transport := &http3.Transport{TLSClientConfig: tlsConfig}
+	defer transport.Close()
+	client = &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	// The UDP listener is started in the background
+	for i := 0; ; i++ {
+		if resp, err = client.Get(url); err == nil {
+			break
+		}
+		if i == 20 {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 3 || resp.StatusCode != http.StatusOK || string(body) != "hello /h3" {
+		t.Fatalf("unexpected response %s %d '%s'", resp.Proto, resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Apply header rules of a route and a location to a request before it gets forwarded
+func modifyRequestHeader(req *http.Request, location *models.RouteLocation) {
+	if location.Route != nil && location.Route.Headers != nil {
+		rules := location.Route.Headers
+		applyHeaderRules(req.Header, rules.RequestAdd, rules.RequestSet, rules.RequestRemove, req, location)
+	}
+
+	if location.Headers != nil {
+		rules := location.Headers
+		applyHeaderRules(req.Header, rules.RequestAdd, rules.RequestSet, rules.RequestRemove, req, location)
+	}
+}
+
+// Apply header rules of a route and a location to a response header
+func modifyResponseHeader(header http.Header, req *http.Request, location *models.RouteLocation) {
+	if location.Route != nil && location.Route.Headers != nil {
+		rules := location.Route.Headers
+		applyHeaderRules(header, rules.ResponseAdd, rules.ResponseSet, rules.ResponseRemove, req, location)
+	}
+
+	if location.Headers != nil {
+		rules := location.Headers
+		applyHeaderRules(header, rules.ResponseAdd, rules.ResponseSet, rules.ResponseRemove, req, location)
+	}
+}
+
+// Remove, set and add headers
+func applyHeaderRules(header http.Header, add, set map[string]string, remove []string, req *http.Request, location *models.RouteLocation) {
+	for _, name := range remove {
+		header.Del(name)
+	}
+
+	for name, value := range set {
+		header.Set(name, expandVariables(value, req, location))
+	}
+
+	for name, value := range add {
+		header.Add(name, expandVariables(value, req, location))
+	}
+}
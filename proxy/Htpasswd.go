@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Minimum time between two checks for changes of a htpasswd file
+const htpasswdCheckInterval = time.Second
+
+// htpasswdFile users of a htpasswd file. The file gets reloaded if it changes
+type htpasswdFile struct {
+	file string
+
+	mutex   sync.RWMutex
+	users   map[string]string
+	modTime time.Time
+	size    int64
+
+	// Unix time in nanoseconds of the last check for changes
+	lastCheck atomic.Int64
+}
+
+// Load a htpasswd file
+func newHtpasswdFile(file string) *htpasswdFile {
+	htpasswd := &htpasswdFile{
+		file:  file,
+		users: make(map[string]string),
+	}
+	htpasswd.reload()
+	return htpasswd
+}
+
+// Reload the file if it has changed since the last load. Only one caller per
+// interval checks the file, requests only wait for the lock if it has changed
+func (htpasswd *htpasswdFile) reload() {
+	now := time.Now()
+	last := htpasswd.lastCheck.Load()
+	if now.Sub(time.Unix(0, last)) < htpasswdCheckInterval || !htpasswd.lastCheck.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	stat, err := os.Stat(htpasswd.file)
+	if err != nil {
+		log.Errorf("Can't read htpasswd file: %s", err)
+		return
+	}
+
+	htpasswd.mutex.RLock()
+	unchanged := stat.ModTime().Equal(htpasswd.modTime) && stat.Size() == htpasswd.size
+	htpasswd.mutex.RUnlock()
+	if unchanged {
+		return
+	}
+
+	f, err := os.Open(htpasswd.file)
+	if err != nil {
+		log.Errorf("Can't read htpasswd file: %s", err)
+		return
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		users[parts[0]] = parts[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Errorf("Can't read htpasswd file: %s", err)
+		return
+	}
+
+	log.Debugf("Loaded %d users from %s", len(users), htpasswd.file)
+	htpasswd.mutex.Lock()
+	htpasswd.users = users
+	htpasswd.modTime = stat.ModTime()
+	htpasswd.size = stat.Size()
+	htpasswd.mutex.Unlock()
+}
+
+// Verify returns true if the password of user matches
+func (htpasswd *htpasswdFile) Verify(user, password string) bool {
+	htpasswd.reload()
+
+	htpasswd.mutex.RLock()
+	hash, ok := htpasswd.users[user]
+	htpasswd.mutex.RUnlock()
+	if !ok {
+		return false
+	}
+
+	return verifyPasswordHash(hash, password)
+}
+
+// Return true if password matches a htpasswd hash
+func verifyPasswordHash(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return secureCompare(hash[5:], base64.StdEncoding.EncodeToString(sum[:]))
+	case strings.HasPrefix(hash, "$apr1$"):
+		parts := strings.SplitN(hash[6:], "$", 2)
+		if len(parts) != 2 {
+			return false
+		}
+		return secureCompare(hash, apr1Hash(password, parts[0]))
+	}
+
+	log.Warn("Unsupported htpasswd hash")
+	return false
+}
+
+// Compare two strings in constant time
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Calculate the Apache MD5 (apr1) hash of a password
+func apr1Hash(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	pw := []byte(password)
+	alternate := md5.Sum([]byte(password + salt + password))
+
+	h := md5.New()
+	h.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			h.Write(alternate[:])
+		} else {
+			h.Write(alternate[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	final := h.Sum(nil)
+
+	// Slow it down
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(final)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(final)
+		} else {
+			h.Write(pw)
+		}
+		final = h.Sum(nil)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(magic + salt + "$")
+	encode := func(value uint, n int) {
+		for ; n > 0; n-- {
+			sb.WriteByte(apr1Alphabet[value&0x3f])
+			value >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(final[group[0]])<<16|uint(final[group[1]])<<8|uint(final[group[2]]), 4)
+	}
+	encode(uint(final[11]), 2)
+
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHtpasswdReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	os.WriteFile(file, []byte("alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\nbob:"+string(bcryptHash)+"\n"), 0600)
+
+	htpasswd := newHtpasswdFile(file)
+
+	// Concurrent requests don't block each other
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !htpasswd.Verify("alice", "password") || htpasswd.Verify("alice", "wrong") {
+				t.Error("unexpected result for alice")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !htpasswd.Verify("bob", "secret") {
+		t.Fatal("expected bob to be verified")
+	}
+
+	// Changes are picked up after the check interval
+	os.WriteFile(file, []byte("bob:"+string(bcryptHash)+"\n"), 0600)
+	os.Chtimes(file, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if !htpasswd.Verify("alice", "password") {
+		t.Fatal("file was reloaded within the check interval")
+	}
+
+	htpasswd.lastCheck.Store(time.Now().Add(-htpasswdCheckInterval).UnixNano())
+	if htpasswd.Verify("alice", "password") {
+		t.Fatal("removed user alice was verified")
+	}
+	if !htpasswd.Verify("bob", "secret") {
+		t.Fatal("expected bob to be verified after the reload")
+	}
+}
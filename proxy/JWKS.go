@@ -0,0 +1,322 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Min time between two fetches of a JWKS document, also after errors
+const jwksRefreshInterval = 30 * time.Second
+
+// jwk a public key used to verify tokens
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// keySet keys of a JWKS document loaded from a file or URL
+type keySet struct {
+	source string
+	ttl    time.Duration
+	client *http.Client
+
+	// Held while loading the document, so it's loaded only once at a time
+	loadMutex sync.Mutex
+
+	mutex     sync.Mutex
+	keys      []jwk
+	loaded    time.Time
+	lastFetch time.Time
+	modTime   time.Time
+}
+
+// Create a key set. Documents from URLs are cached for ttl
+func newKeySet(source string, ttl time.Duration) *keySet {
+	return &keySet{
+		source: source,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (set *keySet) isURL() bool {
+	return strings.HasPrefix(set.source, "http://") || strings.HasPrefix(set.source, "https://")
+}
+
+// Find returns the keys matching kid. All keys are returned if kid is empty
+func (set *keySet) find(kid string) []jwk {
+	keys, reload := set.lookup(kid)
+	if !reload {
+		return keys
+	}
+
+	// Use the current keys while another request loads the document
+	if len(keys) > 0 {
+		if !set.loadMutex.TryLock() {
+			return keys
+		}
+	} else {
+		set.loadMutex.Lock()
+	}
+	defer set.loadMutex.Unlock()
+
+	// The document might have been loaded while waiting
+	if keys, reload = set.lookup(kid); reload {
+		set.reload()
+		keys, _ = set.lookup(kid)
+	}
+
+	return keys
+}
+
+// Return the keys matching kid and whether the document has to be loaded again
+func (set *keySet) lookup(kid string) ([]jwk, bool) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	keys := filterKeys(set.keys, kid)
+	if !set.isURL() {
+		stat, err := os.Stat(set.source)
+		return keys, err == nil && !stat.ModTime().Equal(set.modTime)
+	}
+
+	// Don't hammer the URL, especially if it's down
+	if time.Since(set.lastFetch) < jwksRefreshInterval {
+		return keys, false
+	}
+
+	// The keys might have been rotated
+	return keys, time.Since(set.loaded) > set.ttl || (len(keys) == 0 && len(kid) > 0)
+}
+
+// Load the keys. Keeps the old keys on errors
+func (set *keySet) reload() {
+	var data []byte
+	var err error
+
+	if set.isURL() {
+		set.mutex.Lock()
+		set.lastFetch = time.Now()
+		set.mutex.Unlock()
+
+		data, err = set.fetch()
+	} else {
+		var stat os.FileInfo
+		if stat, err = os.Stat(set.source); err == nil {
+			set.mutex.Lock()
+			set.modTime = stat.ModTime()
+			set.mutex.Unlock()
+
+			data, err = ioutil.ReadFile(set.source)
+		}
+	}
+
+	if err == nil {
+		var keys []jwk
+		if keys, err = parseJWKS(data); err == nil {
+			log.Debugf("Loaded %d keys from %s", len(keys), set.source)
+
+			set.mutex.Lock()
+			set.keys = keys
+			set.loaded = time.Now()
+			set.mutex.Unlock()
+			return
+		}
+	}
+
+	log.Errorf("Can't load JWKS from %s: %s", set.source, err)
+}
+
+func (set *keySet) fetch() ([]byte, error) {
+	resp, err := set.client.Get(set.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// Return the keys with the key id kid. Keys without id match every kid
+func filterKeys(keys []jwk, kid string) []jwk {
+	if len(kid) == 0 {
+		return keys
+	}
+
+	var matching []jwk
+	for _, key := range keys {
+		if key.kid == kid || len(key.kid) == 0 {
+			matching = append(matching, key)
+		}
+	}
+	return matching
+}
+
+// jsonWebKey a key of a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Parse a JWKS document. Keys which can't be used for signatures are skipped
+func parseJWKS(data []byte) ([]jwk, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	var keys []jwk
+	for _, item := range document.Keys {
+		if len(item.Use) > 0 && item.Use != "sig" {
+			continue
+		}
+
+		key, err := item.publicKey()
+		if err != nil {
+			log.Warnf("Skipping JWK '%s': %s", item.Kid, err)
+			continue
+		}
+
+		keys = append(keys, jwk{kid: item.Kid, alg: item.Alg, key: key})
+	}
+
+	return keys, nil
+}
+
+func (item jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch item.Kty {
+	case "RSA":
+		n, err := decode(item.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(item.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch item.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", item.Crv)
+		}
+
+		x, err := decode(item.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(item.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if item.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve '%s'", item.Crv)
+		}
+
+		x, err := decode(item.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type '%s'", item.Kty)
+}
+
+// Load the public keys of a PEM file. Supports public keys and certificates
+func loadPublicKeys(file string) ([]jwk, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []jwk
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var key crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwk{key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public key found")
+	}
+
+	return keys, nil
+}
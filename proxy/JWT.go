@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/JojiiOfficial/gaw"
+)
+
+// Algorithms used if none are configured
+var defaultJWTAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// Curves of the ECDSA algorithms
+var ecdsaCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// jwtClaims the payload of a JSON web token
+type jwtClaims map[string]interface{}
+
+// jwtHeader the header of a JSON web token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+var (
+	errJWTMalformed = errors.New("malformed token")
+	errJWTSignature = errors.New("invalid signature")
+)
+
+// Parse a JSON web token and verify its signature. findKeys returns the keys which
+// may have signed a token with the given key id
+func parseJWT(token string, algorithms []string, findKeys func(kid string) []jwk) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, errJWTMalformed
+	}
+
+	if !gaw.IsInStringArray(header.Alg, algorithms) {
+		return nil, fmt.Errorf("algorithm '%s' not allowed", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+
+	// Try all matching keys
+	verified := false
+	for _, key := range findKeys(header.Kid) {
+		if len(key.alg) > 0 && key.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errJWTSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var claims jwtClaims
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, errJWTMalformed
+	}
+
+	return claims, nil
+}
+
+// Verify the signature of data using alg
+func verifySignature(alg string, key crypto.PublicKey, data, signature []byte) bool {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256", "PS256":
+		hash = crypto.SHA256
+	case "RS384", "ES384", "PS384":
+		hash = crypto.SHA384
+	case "RS512", "ES512", "PS512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, data, signature)
+	default:
+		return false
+	}
+
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			return rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+		}
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(pub, hash, digest, signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		if pub.Curve != ecdsaCurves[alg] {
+			return false
+		}
+
+		// Signatures are the concatenation of r and s
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+
+	return false
+}
+
+// Validate the registered claims exp, nbf, iss and aud. Tokens without exp
+// are only valid if requireExp is false
+func (claims jwtClaims) validate(issuer string, audiences []string, leeway time.Duration, requireExp bool) error {
+	now := time.Now()
+
+	exp, ok := claims.time("exp")
+	if !ok && requireExp {
+		return errors.New("missing exp claim")
+	}
+	if ok && now.After(exp.Add(leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return errors.New("token not valid yet")
+	}
+
+	if len(issuer) > 0 && claims.string("iss") != issuer {
+		return errors.New("invalid issuer")
+	}
+
+	if len(audiences) > 0 {
+		var tokenAudiences []string
+		switch aud := claims["aud"].(type) {
+		case string:
+			tokenAudiences = []string{aud}
+		case []interface{}:
+			for _, item := range aud {
+				if s, ok := item.(string); ok {
+					tokenAudiences = append(tokenAudiences, s)
+				}
+			}
+		}
+
+		found := false
+		for _, aud := range tokenAudiences {
+			if gaw.IsInStringArray(aud, audiences) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("invalid audience")
+		}
+	}
+
+	return nil
+}
+
+// Return a numeric date claim
+func (claims jwtClaims) time(name string) (time.Time, bool) {
+	number, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	value, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// Return a claim as string
+func (claims jwtClaims) string(name string) string {
+	value, _ := claims.lookup(name)
+	return claimString(value)
+}
+
+// Find a claim. Nested claims can be accessed using dots like 'realm_access.roles'
+func (claims jwtClaims) lookup(path string) (interface{}, bool) {
+	if value, ok := claims[path]; ok {
+		return value, true
+	}
+
+	var current interface{} = map[string]interface{}(claims)
+	for _, item := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[item]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// Return true if the claim at path equals value or contains it if it's a list
+func (claims jwtClaims) hasValue(path, value string) bool {
+	claim, ok := claims.lookup(path)
+	if !ok {
+		return false
+	}
+
+	if list, ok := claim.([]interface{}); ok {
+		for _, item := range list {
+			if claimString(item) == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	return claimString(claim) == value
+}
+
+// Format a claim value to be used in a header. Lists are joined by commas
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, claimString(item))
+		}
+		return strings.Join(items, ",")
+	}
+
+	data, _ := json.Marshal(value)
+	return string(data)
+}
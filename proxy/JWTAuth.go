@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// jwtValidator validates the JSON web tokens of requests
+type jwtValidator struct {
+	config *models.JWTAuth
+	static []jwk
+	jwks   *keySet
+}
+
+func newJWTValidator(config *models.JWTAuth) *jwtValidator {
+	validator := &jwtValidator{
+		config: config,
+	}
+
+	for _, file := range config.KeyFiles {
+		keys, err := loadPublicKeys(file)
+		if err != nil {
+			log.Errorf("Can't load JWT keys from %s: %s", file, err)
+			continue
+		}
+		validator.static = append(validator.static, keys...)
+	}
+
+	if len(config.JWKS) > 0 {
+		validator.jwks = newKeySet(config.JWKS, config.GetJWKSCacheTTL())
+	}
+
+	return validator
+}
+
+func (validator *jwtValidator) algorithms() []string {
+	if len(validator.config.Algorithms) == 0 {
+		return defaultJWTAlgorithms
+	}
+	return validator.config.Algorithms
+}
+
+// Return the keys which may have signed a token with kid
+func (validator *jwtValidator) findKeys(kid string) []jwk {
+	keys := filterKeys(validator.static, kid)
+	if validator.jwks != nil {
+		keys = append(keys, validator.jwks.find(kid)...)
+	}
+	return keys
+}
+
+// Return the token of a request
+func (validator *jwtValidator) token(req *http.Request) string {
+	if authorization := req.Header.Get("Authorization"); len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+
+	if len(validator.config.Cookie) > 0 {
+		if cookie, err := req.Cookie(validator.config.Cookie); err == nil {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+// Validate the token of a request. Returns the username and true on success.
+// Otherwise the response has been written already
+func (validator *jwtValidator) authenticate(w http.ResponseWriter, req *http.Request) (string, bool) {
+	config := validator.config
+
+	// Don't let clients set the claim headers
+	for name := range config.ClaimHeaders {
+		req.Header.Del(name)
+	}
+
+	token := validator.token(req)
+	if len(token) == 0 {
+		validator.deny(w, http.StatusUnauthorized, "", "")
+		return "", false
+	}
+
+	claims, err := parseJWT(token, validator.algorithms(), validator.findKeys)
+	if err == nil {
+		err = claims.validate(config.Issuer, config.Audiences, time.Duration(config.Leeway), !config.AllowMissingExp)
+	}
+	if err != nil {
+		log.Debugf("Invalid token from %s: %s", req.RemoteAddr, err)
+		validator.deny(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return "", false
+	}
+
+	for name, value := range config.RequiredClaims {
+		if _, ok := claims.lookup(name); !ok || (len(value) > 0 && !claims.hasValue(name, value)) {
+			log.Debugf("Token from %s is missing claim '%s'", req.RemoteAddr, name)
+			validator.deny(w, http.StatusForbidden, "insufficient_scope", "missing claim "+name)
+			return "", false
+		}
+	}
+
+	for name, claim := range config.ClaimHeaders {
+		if value := claims.string(claim); len(value) > 0 {
+			req.Header.Set(name, value)
+		}
+	}
+
+	return claims.string(config.GetUserClaim()), true
+}
+
+// Write a response with a WWW-Authenticate header as defined in RFC 6750
+func (validator *jwtValidator) deny(w http.ResponseWriter, status int, errorCode, description string) {
+	challenge := "Bearer"
+	if len(validator.config.Realm) > 0 {
+		challenge += ` realm="` + validator.config.Realm + `"`
+	}
+
+	if len(errorCode) > 0 {
+		if challenge != "Bearer" {
+			challenge += ","
+		}
+		challenge += ` error="` + errorCode + `", error_description="` + strings.ReplaceAll(description, `"`, "'") + `"`
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(status), status)
+}
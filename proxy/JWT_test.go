@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// testKey a private key with its JWK representation
+type testKey struct {
+	alg     string
+	kid     string
+	private crypto.Signer
+}
+
+func newTestKey(t *testing.T, alg, kid string) *testKey {
+	t.Helper()
+
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKey{alg: alg, kid: kid, private: private}
+}
+
+// Return the public key as JWK
+func (key *testKey) jwk() map[string]string {
+	encode := base64.RawURLEncoding.EncodeToString
+	item := map[string]string{"kid": key.kid, "alg": key.alg, "use": "sig"}
+
+	switch pub := key.private.Public().(type) {
+	case *rsa.PublicKey:
+		item["kty"] = "RSA"
+		item["n"] = encode(pub.N.Bytes())
+		item["e"] = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		item["kty"] = "EC"
+		item["crv"] = "P-256"
+		item["x"] = encode(pub.X.FillBytes(make([]byte, 32)))
+		item["y"] = encode(pub.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		item["kty"] = "OKP"
+		item["crv"] = "Ed25519"
+		item["x"] = encode(pub)
+	}
+
+	return item
+}
+
+// Create a signed token containing claims
+func (key *testKey) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": key.alg, "kid": key.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	data := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	var err error
+	switch private := key.private.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(private, []byte(data))
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(data))
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand.Reader, private, digest[:]); err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	default:
+		digest := sha256.Sum256([]byte(data))
+		signature, err = key.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Serve a JWKS document of keys. Returns the server and a counter of fetches
+func newJWKSServer(t *testing.T, keys ...*testKey) (*httptest.Server, *int64) {
+	t.Helper()
+
+	var fetches int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+
+		var items []map[string]string
+		for _, key := range keys {
+			items = append(items, key.jwk())
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": items})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &fetches
+}
+
+func authenticateToken(validator *jwtValidator, token string) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "http://x/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rec := httptest.NewRecorder()
+	user, ok := validator.authenticate(rec, req)
+	if ok {
+		return http.StatusOK, user
+	}
+	return rec.Code, rec.Header().Get("WWW-Authenticate")
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	for _, alg := range defaultJWTAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			key := newTestKey(t, alg, "key-"+alg)
+			server, _ := newJWKSServer(t, key)
+			validator := newJWTValidator(&models.JWTAuth{JWKS: server.URL})
+
+			code, user := authenticateToken(validator, key.sign(t, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}))
+			if code != http.StatusOK || user != "alice" {
+				t.Fatalf("expected alice to be authenticated, got %d %q", code, user)
+			}
+
+			// A different key with the same id
+			other := newTestKey(t, alg, key.kid)
+			if code, _ := authenticateToken(validator, other.sign(t, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})); code != http.StatusUnauthorized {
+				t.Fatalf("expected 401 for a foreign signature, got %d", code)
+			}
+		})
+	}
+}
+
+func TestJWTAlgorithmNotAllowed(t *testing.T) {
+	key := newTestKey(t, "ES256", "es")
+	server, _ := newJWKSServer(t, key)
+	validator := newJWTValidator(&models.JWTAuth{JWKS: server.URL, Algorithms: []string{"RS256"}})
+
+	if code, _ := authenticateToken(validator, key.sign(t, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", code)
+	}
+}
+
+func TestJWTClaims(t *testing.T) {
+	key := newTestKey(t, "ES256", "es")
+	server, _ := newJWKSServer(t, key)
+	validator := newJWTValidator(&models.JWTAuth{
+		JWKS:      server.URL,
+		Issuer:    "https://issuer",
+		Audiences: []string{"api"},
+		Leeway:    models.ConfigDuration(time.Minute),
+	})
+
+	now := time.Now().Unix()
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{"valid", map[string]interface{}{"iss": "https://issuer", "aud": "api", "exp": now + 60, "nbf": now}, true},
+		{"audience list", map[string]interface{}{"iss": "https://issuer", "aud": []string{"web", "api"}, "exp": now + 60}, true},
+		{"expired within leeway", map[string]interface{}{"iss": "https://issuer", "aud": "api", "exp": now - 30}, true},
+		{"expired", map[string]interface{}{"iss": "https://issuer", "aud": "api", "exp": now - 120}, false},
+		{"missing exp", map[string]interface{}{"iss": "https://issuer", "aud": "api"}, false},
+		{"not valid yet", map[string]interface{}{"iss": "https://issuer", "aud": "api", "exp": now + 180, "nbf": now + 120}, false},
+		{"wrong issuer", map[string]interface{}{"iss": "https://other", "aud": "api", "exp": now + 60}, false},
+		{"missing issuer", map[string]interface{}{"aud": "api", "exp": now + 60}, false},
+		{"wrong audience", map[string]interface{}{"iss": "https://issuer", "aud": "web", "exp": now + 60}, false},
+		{"missing audience", map[string]interface{}{"iss": "https://issuer", "exp": now + 60}, false},
+	}
+
+	for _, test := range tests {
+		code, challenge := authenticateToken(validator, key.sign(t, test.claims))
+		if test.valid && code != http.StatusOK {
+			t.Errorf("%s: expected token to be valid, got %d %q", test.name, code, challenge)
+		}
+		if !test.valid && code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", test.name, code)
+		}
+	}
+
+	// Tokens without exp can be allowed explicitly
+	validator = newJWTValidator(&models.JWTAuth{JWKS: server.URL, AllowMissingExp: true})
+	if code, challenge := authenticateToken(validator, key.sign(t, map[string]interface{}{"sub": "alice"})); code != http.StatusOK {
+		t.Fatalf("expected a token without exp to be allowed, got %d %q", code, challenge)
+	}
+}
+
+func TestJWKSRefetch(t *testing.T) {
+	key := newTestKey(t, "EdDSA", "current")
+	server, fetches := newJWKSServer(t, key)
+	validator := newJWTValidator(&models.JWTAuth{JWKS: server.URL})
+
+	authenticateToken(validator, key.sign(t, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}))
+
+	// Unknown key ids don't cause a fetch within the refresh interval
+	unknown := newTestKey(t, "EdDSA", "unknown")
+	for i := 0; i < 5; i++ {
+		authenticateToken(validator, unknown.sign(t, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}))
+	}
+	if n := atomic.LoadInt64(fetches); n != 1 {
+		t.Fatalf("expected 1 fetch, got %d", n)
+	}
+
+	// Unless the interval has passed
+	validator.jwks.mutex.Lock()
+	validator.jwks.lastFetch = time.Now().Add(-jwksRefreshInterval)
+	validator.jwks.mutex.Unlock()
+
+	authenticateToken(validator, unknown.sign(t, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}))
+	if n := atomic.LoadInt64(fetches); n != 2 {
+		t.Fatalf("expected 2 fetches, got %d", n)
+	}
+}
+
+func TestJWKSUnreachable(t *testing.T) {
+	var fetches int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	key := newTestKey(t, "ES256", "es")
+	validator := newJWTValidator(&models.JWTAuth{JWKS: server.URL})
+
+	// Failed fetches aren't repeated for every request
+	for i := 0; i < 5; i++ {
+		if code, _ := authenticateToken(validator, key.sign(t, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})); code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", code)
+		}
+	}
+	if n := atomic.LoadInt64(&fetches); n != 1 {
+		t.Fatalf("expected 1 fetch, got %d", n)
+	}
+}
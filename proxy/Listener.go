@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Listen on a TCP address or unix socket. Accepts PROXY protocol headers if
+// configured
+func listen(address *models.ListenAddress) (net.Listener, error) {
+	var listener net.Listener
+	var err error
+	if address.IsUnix() {
+		listener, err = listenUnix(address)
+	} else {
+		listener, err = net.Listen("tcp", address.GetAddress())
+	}
+
+	if err != nil || address.ProxyProtocol == nil {
+		return listener, err
+	}
+	return proxyProtocolListener(listener, address.ProxyProtocol), nil
+}
+
+// Listen on a unix socket. Removes sockets left by previous runs and applies
+// the file settings of the address
+func listenUnix(address *models.ListenAddress) (net.Listener, error) {
+	socketPath := address.SocketPath()
+
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("'%s' exists and isn't a socket", socketPath)
+		}
+
+		// Only remove the socket if nobody listens on it
+		if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket '%s' is in use", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if address.UnixSocket != nil {
+		if err := applySocketConfig(socketPath, address.UnixSocket); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
+
+// Set the mode and owner of a socket
+func applySocketConfig(socketPath string, config *models.UnixSocketConfig) error {
+	if mode, ok := config.GetMode(); ok {
+		if err := os.Chmod(socketPath, os.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	uid, gid := -1, -1
+	if len(config.User) > 0 {
+		u, err := user.Lookup(config.User)
+		if err != nil {
+			if u, err = user.LookupId(config.User); err != nil {
+				return err
+			}
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+	if len(config.Group) > 0 {
+		g, err := user.LookupGroup(config.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(config.Group); err != nil {
+				return err
+			}
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	return os.Chown(socketPath, uid, gid)
+}
+
+// Transports of unix socket destinations by socket path
+var unixTransports sync.Map
+
+// Return the transport connecting to the HTTP server on a unix socket
+func unixTransport(socketPath string) http.RoundTripper {
+	if transport, ok := unixTransports.Load(socketPath); ok {
+		return transport.(*http.Transport)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}
+
+	actual, _ := unixTransports.LoadOrStore(socketPath, transport)
+	return actual.(*http.Transport)
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+func TestListenUnix(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "proxy.sock")
+	address := &models.ListenAddress{
+		Address:    models.UnixScheme + "://" + socketPath,
+		UnixSocket: &models.UnixSocketConfig{Mode: "0600"},
+	}
+
+	// Sockets left by previous runs get removed
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenUnix(address)
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced: %s", err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// Sockets still in use are kept
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	if _, err := listenUnix(address); err == nil {
+		t.Fatal("expected a socket in use to be refused")
+	}
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Fatalf("socket in use was removed: %s", err)
+	}
+
+	// Other files are never removed
+	filePath := filepath.Join(t.TempDir(), "file.sock")
+	os.WriteFile(filePath, []byte("data"), 0600)
+	if _, err := listenUnix(&models.ListenAddress{Address: models.UnixScheme + "://" + filePath}); err == nil {
+		t.Fatal("expected a regular file to be refused")
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		t.Fatalf("regular file was removed: %s", err)
+	}
+}
+
+func TestUnixDestination(t *testing.T) {
+	tests := []struct {
+		destination string
+		socketPath  string
+		url         string
+	}{
+		{"unix:///run/app.sock", "/run/app.sock", "http://localhost/"},
+		{"unix:///run/app.sock:/api/", "/run/app.sock", "http://localhost/api/"},
+		{"unix:///run/app.sock:/api/?x=1", "/run/app.sock", "http://localhost/api/?x=1"},
+	}
+
+	for _, test := range tests {
+		route := &models.Route{ServerNames: []string{"x"}}
+		location := models.RouteLocation{Location: "/", Destination: test.destination}
+		location.Init(route)
+
+		if location.UnixSocket != test.socketPath || location.DestinationURL.String() != test.url {
+			t.Errorf("%s: expected '%s' '%s', got '%s' '%s'", test.destination, test.socketPath, test.url, location.UnixSocket, location.DestinationURL)
+		}
+	}
+
+	// Requests are forwarded to the HTTP server on the socket
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})}
+	go upstream.Serve(listener)
+	defer upstream.Close()
+
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations:   []models.RouteLocation{{Location: "/", Destination: models.UnixScheme + "://" + socketPath + ":/api/"}},
+	})
+
+	resp, err := http.Get("http://" + server.Server[0].ListenAddress.Address + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "/api/a" {
+		t.Fatalf("unexpected response %d '%s'", resp.StatusCode, body)
+	}
+}
+
+func TestIsLoop(t *testing.T) {
+	route := &models.Route{
+		ServerNames: []string{"x"},
+		ListenAddresses: []*models.ListenAddress{
+			{Address: models.UnixScheme + ":///run/proxy.sock"},
+			{Address: "127.0.0.1:8080"},
+		},
+	}
+
+	tests := map[string]bool{
+		"unix:///run/proxy.sock":          true,
+		"unix:///run/../run/proxy.sock:/": true,
+		"unix:///run/app.sock":            false,
+		"http://127.0.0.1:8080/":          true,
+		"http://127.0.0.1:8081/":          false,
+		"http://127.0.0.1/":               false,
+		"http://192.0.2.1:8080/":          false,
+		"fcgi+unix:///run/php.sock":       false,
+	}
+
+	for destination, expected := range tests {
+		location := models.RouteLocation{Location: "/", Destination: destination}
+		location.Init(route)
+
+		if location.IsLoop() != expected {
+			t.Errorf("%s: expected %v", destination, expected)
+		}
+	}
+}
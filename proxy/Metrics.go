@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Types of metrics
+const (
+	gaugeMetric   = "gauge"
+	counterMetric = "counter"
+)
+
+// metric a single value of a metric family
+type metric struct {
+	value int64
+}
+
+func (m *metric) add(n int64) {
+	atomic.AddInt64(&m.value, n)
+}
+
+func (m *metric) get() int64 {
+	return atomic.LoadInt64(&m.value)
+}
+
+// metricFamily all values of a metric, keyed by their labels
+type metricFamily struct {
+	kind   string
+	help   string
+	values map[string]*metric
+}
+
+// metricsRegistry holds all metrics of the proxy
+type metricsRegistry struct {
+	mutex    sync.Mutex
+	families map[string]*metricFamily
+}
+
+// metrics exposed by the admin interface
+var metrics = &metricsRegistry{families: make(map[string]*metricFamily)}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Return the metric with the given name and labels. Labels are passed as
+// name value pairs
+func (registry *metricsRegistry) get(kind, name, help string, labels ...string) *metric {
+	var sb strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	key := sb.String()
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	family, ok := registry.families[name]
+	if !ok {
+		family = &metricFamily{kind: kind, help: help, values: make(map[string]*metric)}
+		registry.families[name] = family
+	}
+
+	m, ok := family.values[key]
+	if !ok {
+		m = &metric{}
+		family.values[key] = m
+	}
+	return m
+}
+
+// Write all metrics in the Prometheus text format
+func (registry *metricsRegistry) write(w io.Writer) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	names := make([]string, 0, len(registry.families))
+	for name := range registry.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := registry.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.kind)
+
+		keys := make([]string, 0, len(family.values))
+		for key := range family.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if len(key) > 0 {
+				fmt.Fprintf(w, "%s{%s} %d\n", name, key, family.values[key].get())
+			} else {
+				fmt.Fprintf(w, "%s %d\n", name, family.values[key].get())
+			}
+		}
+	}
+}
@@ -0,0 +1,519 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Time a login has to be finished in
+const oidcLoginTimeout = 10 * time.Minute
+
+// Min time between two discovery attempts after an error
+const oidcDiscoveryRetry = 10 * time.Second
+
+// OIDCProvider OpenID Connect relying party of a route
+type OIDCProvider struct {
+	Config *models.OIDCConfig
+
+	codec  *cookieCodec
+	client *http.Client
+
+	mutex         sync.Mutex
+	discovery     *oidcDiscovery
+	keys          *keySet
+	lastDiscovery time.Time
+}
+
+// oidcDiscovery the parts of the discovery document which are used
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcSession data stored in the session cookie
+type oidcSession struct {
+	Claims       jwtClaims `json:"c"`
+	RefreshToken string    `json:"r,omitempty"`
+	// Sent to the end session endpoint on logout
+	IDToken string `json:"i,omitempty"`
+	// Time the claims have to be refreshed
+	Expiry int64 `json:"e"`
+	// Time of the login
+	Created int64 `json:"t"`
+}
+
+// oidcLogin data stored in a cookie while logging in
+type oidcLogin struct {
+	State       string `json:"s"`
+	Verifier    string `json:"v"`
+	Nonce       string `json:"n"`
+	RedirectURI string `json:"r"`
+}
+
+// oidcTokenResponse response of the token endpoint
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// NewOIDCProvider create a new relying party for a route
+func NewOIDCProvider(config *models.OIDCConfig) (*OIDCProvider, error) {
+	codec, err := newCookieCodec(config.CookieSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCProvider{
+		Config: config,
+		codec:  codec,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Load the discovery document of the issuer. Gets cached after the first success
+func (provider *OIDCProvider) getDiscovery() (*oidcDiscovery, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+	if time.Since(provider.lastDiscovery) < oidcDiscoveryRetry {
+		return nil, errors.New("discovery failed recently")
+	}
+	provider.lastDiscovery = time.Now()
+
+	resp, err := provider.client.Get(strings.TrimSuffix(provider.Config.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery responded with status %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(provider.Config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery returned issuer '%s'", discovery.Issuer)
+	}
+	if len(discovery.AuthorizationEndpoint) == 0 || len(discovery.TokenEndpoint) == 0 || len(discovery.JWKSURI) == 0 {
+		return nil, errors.New("discovery document is incomplete")
+	}
+
+	provider.discovery = &discovery
+	provider.keys = newKeySet(discovery.JWKSURI, time.Hour)
+	return provider.discovery, nil
+}
+
+// Return a cookie with the attributes used for all cookies of the provider
+func (provider *OIDCProvider) cookie(req *http.Request, name, path string) http.Cookie {
+	return http.Cookie{
+		Name:     name,
+		Path:     path,
+		Domain:   provider.Config.CookieDomain,
+		HttpOnly: true,
+		Secure:   requestScheme(req) == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (provider *OIDCProvider) sessionCookie(req *http.Request) http.Cookie {
+	return provider.cookie(req, provider.Config.GetCookieName(), "/")
+}
+
+func (provider *OIDCProvider) loginCookie(req *http.Request) http.Cookie {
+	cookie := provider.cookie(req, provider.Config.GetCookieName()+"_login", provider.Config.GetCallbackPath())
+	cookie.MaxAge = int(oidcLoginTimeout.Seconds())
+	return cookie
+}
+
+// Return the absolute URL of path on the requested host
+func (provider *OIDCProvider) publicURL(req *http.Request, path string) string {
+	return requestScheme(req) + "://" + req.Host + path
+}
+
+// Handle the callback and logout paths. Returns true if the request was handled
+func (provider *OIDCProvider) handle(w http.ResponseWriter, req *http.Request) bool {
+	switch req.URL.Path {
+	case provider.Config.GetCallbackPath():
+		provider.callback(w, req)
+		return true
+	case provider.Config.GetLogoutPath():
+		provider.logout(w, req)
+		return true
+	}
+	return false
+}
+
+// Return the valid session of a request. Expired sessions get refreshed if possible
+func (provider *OIDCProvider) session(w http.ResponseWriter, req *http.Request) *oidcSession {
+	var session oidcSession
+	if err := provider.codec.readCookie(req, provider.Config.GetCookieName(), &session); err != nil {
+		if err != http.ErrNoCookie {
+			log.Debugf("Invalid session cookie from %s: %s", req.RemoteAddr, err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	if now.After(time.Unix(session.Created, 0).Add(provider.Config.GetSessionLifetime())) {
+		return nil
+	}
+	if now.Before(time.Unix(session.Expiry, 0)) {
+		return &session
+	}
+
+	// Refresh the session
+	if len(session.RefreshToken) == 0 {
+		return nil
+	}
+
+	tokens, err := provider.requestTokens(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {session.RefreshToken},
+	})
+	if err != nil {
+		log.Debugf("Can't refresh session: %s", err)
+		return nil
+	}
+
+	if len(tokens.IDToken) > 0 {
+		claims, err := provider.verifyIDToken(tokens.IDToken, "")
+		if err != nil {
+			log.Warnf("Invalid ID token on refresh: %s", err)
+			return nil
+		}
+		session.Claims = claims
+		session.IDToken = tokens.IDToken
+	}
+	if len(tokens.RefreshToken) > 0 {
+		session.RefreshToken = tokens.RefreshToken
+	}
+	session.Expiry = sessionExpiry(tokens, session.Claims)
+
+	if err := provider.codec.setCookie(w, req, provider.sessionCookie(req), &session); err != nil {
+		log.Error(err)
+	}
+
+	return &session
+}
+
+// Redirect the client to the login page of the issuer
+func (provider *OIDCProvider) login(w http.ResponseWriter, req *http.Request) {
+	// Other requests can't be continued after a redirect
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		log.Errorf("OIDC discovery failed: %s", err)
+		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	login := oidcLogin{
+		State:       randomString(),
+		Verifier:    randomString() + randomString(),
+		Nonce:       randomString(),
+		RedirectURI: req.URL.RequestURI(),
+	}
+
+	if err := provider.codec.setCookie(w, req, provider.loginCookie(req), &login); err != nil {
+		log.Error(err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.Config.ClientID},
+		"redirect_uri":          {provider.publicURL(req, provider.Config.GetCallbackPath())},
+		"scope":                 {strings.Join(provider.Config.GetScopes(), " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	target := discovery.AuthorizationEndpoint
+	if strings.Contains(target, "?") {
+		target += "&" + query.Encode()
+	} else {
+		target += "?" + query.Encode()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, req, target, http.StatusFound)
+}
+
+// Handle the redirect of the issuer after a login
+func (provider *OIDCProvider) callback(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	var login oidcLogin
+	loginCookie := provider.loginCookie(req)
+	if err := provider.codec.readCookie(req, loginCookie.Name, &login); err != nil || len(query.Get("state")) == 0 || !secureCompare(query.Get("state"), login.State) {
+		log.Debugf("Invalid OIDC callback from %s", req.RemoteAddr)
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		return
+	}
+	clearCookie(w, req, loginCookie)
+
+	if errorCode := query.Get("error"); len(errorCode) > 0 {
+		log.Debugf("OIDC login failed: %s %s", errorCode, query.Get("error_description"))
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	tokens, err := provider.requestTokens(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {query.Get("code")},
+		"redirect_uri":  {provider.publicURL(req, provider.Config.GetCallbackPath())},
+		"code_verifier": {login.Verifier},
+	})
+	if err != nil {
+		log.Warnf("OIDC code exchange failed: %s", err)
+		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	claims, err := provider.verifyIDToken(tokens.IDToken, login.Nonce)
+	if err != nil {
+		log.Warnf("Invalid ID token: %s", err)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	session := oidcSession{
+		Claims:       claims,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Expiry:       sessionExpiry(tokens, claims),
+		Created:      time.Now().Unix(),
+	}
+	if err := provider.codec.setCookie(w, req, provider.sessionCookie(req), &session); err != nil {
+		log.Error(err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Only redirect to paths on the same host
+	target := login.RedirectURI
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		target = "/"
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, req, target, http.StatusFound)
+}
+
+// End the session and log out at the issuer if supported. Only POST requests
+// from the same origin are accepted, so other sites can't log users out
+func (provider *OIDCProvider) logout(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if origin := req.Header.Get("Origin"); len(origin) > 0 && origin != provider.publicURL(req, "") {
+		log.Debugf("Rejecting logout from origin '%s'", origin)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var session oidcSession
+	provider.codec.readCookie(req, provider.Config.GetCookieName(), &session)
+	clearCookie(w, req, provider.sessionCookie(req))
+
+	target := provider.Config.PostLogoutRedirect
+	if len(target) == 0 {
+		target = "/"
+	}
+
+	if discovery, err := provider.getDiscovery(); err == nil && len(discovery.EndSessionEndpoint) > 0 {
+		if strings.HasPrefix(target, "/") {
+			target = provider.publicURL(req, target)
+		}
+
+		query := url.Values{
+			"client_id":                {provider.Config.ClientID},
+			"post_logout_redirect_uri": {target},
+		}
+		if len(session.IDToken) > 0 {
+			query.Set("id_token_hint", session.IDToken)
+		}
+		target = discovery.EndSessionEndpoint
+		if strings.Contains(target, "?") {
+			target += "&" + query.Encode()
+		} else {
+			target += "?" + query.Encode()
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, req, target, http.StatusSeeOther)
+}
+
+// Send a request to the token endpoint
+func (provider *OIDCProvider) requestTokens(form url.Values) (*oidcTokenResponse, error) {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form.Set("client_id", provider.Config.ClientID)
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(provider.Config.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(provider.Config.ClientID), url.QueryEscape(provider.Config.ClientSecret))
+	}
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens oidcTokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint responded with status %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || len(tokens.Error) > 0 {
+		return nil, fmt.Errorf("token endpoint responded with status %d: %s", resp.StatusCode, tokens.Error)
+	}
+
+	return &tokens, nil
+}
+
+// Verify an ID token and return its claims
+func (provider *OIDCProvider) verifyIDToken(token, nonce string) (jwtClaims, error) {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := parseJWT(token, models.JWTAlgorithms, provider.keys.find)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := claims.validate(discovery.Issuer, []string{provider.Config.ClientID}, time.Minute, true); err != nil {
+		return nil, err
+	}
+
+	if len(nonce) > 0 && !secureCompare(claims.string("nonce"), nonce) {
+		return nil, errors.New("invalid nonce")
+	}
+
+	return claims, nil
+}
+
+// Return the time the session has to be refreshed
+func sessionExpiry(tokens *oidcTokenResponse, claims jwtClaims) int64 {
+	if tokens.ExpiresIn > 0 {
+		return time.Now().Unix() + tokens.ExpiresIn
+	}
+	if exp, ok := claims.time("exp"); ok {
+		return exp.Unix()
+	}
+	return time.Now().Add(time.Hour).Unix()
+}
+
+// Return a random url safe string
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Check the OIDC session of a request against the requirements of a location.
+// Returns the username and true on success. Otherwise the response has been
+// written already
+func (provider *OIDCProvider) authenticate(w http.ResponseWriter, req *http.Request, requirements *models.OIDCAuth) (string, bool) {
+	// Don't let clients set the claim headers
+	for name := range provider.Config.ClaimHeaders {
+		req.Header.Del(name)
+	}
+
+	if requirements != nil && requirements.Public {
+		return "", true
+	}
+
+	session := provider.session(w, req)
+	if session == nil {
+		provider.login(w, req)
+		return "", false
+	}
+	claims := session.Claims
+
+	if requirements != nil {
+		if len(requirements.Groups) > 0 {
+			member := false
+			for _, group := range requirements.Groups {
+				if claims.hasValue(requirements.GetGroupsClaim(), group) {
+					member = true
+					break
+				}
+			}
+
+			if !member {
+				log.Debugf("User '%s' is not in a required group", claims.string("sub"))
+				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				return "", false
+			}
+		}
+
+		for name, value := range requirements.RequiredClaims {
+			if _, ok := claims.lookup(name); !ok || (len(value) > 0 && !claims.hasValue(name, value)) {
+				log.Debugf("User '%s' is missing claim '%s'", claims.string("sub"), name)
+				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				return "", false
+			}
+		}
+	}
+
+	for name, claim := range provider.Config.ClaimHeaders {
+		if value := claims.string(claim); len(value) > 0 {
+			req.Header.Set(name, value)
+		}
+	}
+
+	return claims.string(provider.Config.GetUserClaim()), true
+}
@@ -0,0 +1,394 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// mockIssuer an OpenID Connect provider issuing tokens for a single user
+type mockIssuer struct {
+	*httptest.Server
+	t   *testing.T
+	key *testKey
+
+	mutex     sync.Mutex
+	challenge string
+	nonce     string
+	grants    []url.Values
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	issuer := &mockIssuer{t: t, key: newTestKey(t, "ES256", "issuer")}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+			"end_session_endpoint":   issuer.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{issuer.key.jwk()}})
+	})
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// Remember the PKCE challenge and nonce of an authorization request
+func (issuer *mockIssuer) authorize(query url.Values) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.challenge = query.Get("code_challenge")
+	issuer.nonce = query.Get("nonce")
+}
+
+func (issuer *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+
+	if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	r.ParseForm()
+	issuer.grants = append(issuer.grants, r.PostForm)
+
+	claims := map[string]interface{}{
+		"iss":    issuer.URL,
+		"aud":    "client",
+		"sub":    "alice",
+		"groups": []string{"admins"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != issuer.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims["nonce"] = issuer.nonce
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != "refresh" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims["refreshed"] = true
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  "access",
+		"id_token":      issuer.key.sign(issuer.t, claims),
+		"refresh_token": "refresh",
+		"expires_in":    300,
+	})
+}
+
+func newTestOIDCProvider(t *testing.T, issuer *mockIssuer) *OIDCProvider {
+	provider, err := NewOIDCProvider(&models.OIDCConfig{
+		Issuer:             issuer.URL,
+		ClientID:           "client",
+		ClientSecret:       "secret",
+		CookieSecret:       "cookie secret",
+		PostLogoutRedirect: "/bye",
+		ClaimHeaders:       map[string]string{"X-User": "sub"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// Create a request carrying the cookies which are still set
+func newCookieRequest(method, target string, cookies []*http.Cookie) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	for _, cookie := range cookies {
+		if cookie.MaxAge >= 0 {
+			req.AddCookie(cookie)
+		}
+	}
+	return req
+}
+
+// Log in using the authorization code flow. Returns the session cookies
+func loginAtMockIssuer(t *testing.T, issuer *mockIssuer, provider *OIDCProvider) []*http.Cookie {
+	t.Helper()
+
+	// Unauthenticated requests are redirected to the issuer
+	rec := httptest.NewRecorder()
+	if _, ok := provider.authenticate(rec, httptest.NewRequest(http.MethodGet, "http://app/private?x=1", nil), nil); ok || rec.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the issuer, got %d", rec.Code)
+	}
+
+	target, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(target.String(), issuer.URL+"/authorize?") {
+		t.Fatalf("unexpected redirect '%s'", rec.Header().Get("Location"))
+	}
+
+	query := target.Query()
+	for name, expected := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "http://app/oauth2/callback",
+		"scope":                 "openid profile email",
+		"code_challenge_method": "S256",
+	} {
+		if query.Get(name) != expected {
+			t.Errorf("expected %s '%s', got '%s'", name, expected, query.Get(name))
+		}
+	}
+	for _, name := range []string{"state", "nonce", "code_challenge"} {
+		if len(query.Get(name)) == 0 {
+			t.Errorf("missing %s", name)
+		}
+	}
+	issuer.authorize(query)
+
+	// The issuer redirects back to the callback
+	callback := newCookieRequest(http.MethodGet, "http://app/oauth2/callback?code=code&state="+url.QueryEscape(query.Get("state")), rec.Result().Cookies())
+	rec = httptest.NewRecorder()
+	if !provider.handle(rec, callback) {
+		t.Fatal("callback wasn't handled")
+	}
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/private?x=1" {
+		t.Fatalf("expected a redirect to the requested page, got %d '%s'", rec.Code, rec.Header().Get("Location"))
+	}
+
+	var cookies []*http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == provider.Config.GetCookieName() {
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("session cookie attributes missing")
+			}
+			cookies = append(cookies, cookie)
+		}
+	}
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie set")
+	}
+
+	return cookies
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+	cookies := loginAtMockIssuer(t, issuer, provider)
+
+	// The session cookie is encrypted
+	if strings.Contains(cookies[0].Value, "alice") {
+		t.Fatal("session cookie isn't encrypted")
+	}
+
+	req := newCookieRequest(http.MethodGet, "http://app/private", cookies)
+	req.Header.Set("X-User", "mallory")
+	user, ok := provider.authenticate(httptest.NewRecorder(), req, &models.OIDCAuth{Groups: []string{"admins"}})
+	if !ok || user != "alice" || req.Header.Get("X-User") != "alice" {
+		t.Fatalf("expected alice to be logged in, got %v '%s' '%s'", ok, user, req.Header.Get("X-User"))
+	}
+
+	rec := httptest.NewRecorder()
+	if _, ok := provider.authenticate(rec, newCookieRequest(http.MethodGet, "http://app/private", cookies), &models.OIDCAuth{Groups: []string{"staff"}}); ok || rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a missing group, got %d", rec.Code)
+	}
+
+	// Modified cookies are rejected
+	tampered := *cookies[0]
+	flipped := []byte(tampered.Value)
+	flipped[20] ^= 1
+	tampered.Value = string(flipped)
+	rec = httptest.NewRecorder()
+	if _, ok := provider.authenticate(rec, newCookieRequest(http.MethodGet, "http://app/private", []*http.Cookie{&tampered}), nil); ok || rec.Code != http.StatusFound {
+		t.Fatalf("expected a tampered cookie to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+
+	rec := httptest.NewRecorder()
+	provider.authenticate(rec, httptest.NewRequest(http.MethodGet, "http://app/", nil), nil)
+
+	callback := newCookieRequest(http.MethodGet, "http://app/oauth2/callback?code=code&state=forged", rec.Result().Cookies())
+	rec = httptest.NewRecorder()
+	provider.handle(rec, callback)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid state, got %d", rec.Code)
+	}
+
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	if len(issuer.grants) > 0 {
+		t.Fatal("code was exchanged for an invalid state")
+	}
+}
+
+func TestOIDCRefresh(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+	cookies := loginAtMockIssuer(t, issuer, provider)
+
+	// Let the session expire
+	var session oidcSession
+	if err := provider.codec.readCookie(newCookieRequest(http.MethodGet, "http://app/", cookies), provider.Config.GetCookieName(), &session); err != nil {
+		t.Fatal(err)
+	}
+	session.Expiry = time.Now().Add(-time.Minute).Unix()
+	value, err := provider.codec.encode(provider.Config.GetCookieName(), &session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := []*http.Cookie{{Name: provider.Config.GetCookieName(), Value: value}}
+
+	rec := httptest.NewRecorder()
+	user, ok := provider.authenticate(rec, newCookieRequest(http.MethodGet, "http://app/private", expired), nil)
+	if !ok || user != "alice" {
+		t.Fatalf("expected the session to be refreshed, got %v %d", ok, rec.Code)
+	}
+
+	issuer.mutex.Lock()
+	grant := issuer.grants[len(issuer.grants)-1]
+	issuer.mutex.Unlock()
+	if grant.Get("grant_type") != "refresh_token" || grant.Get("refresh_token") != "refresh" {
+		t.Fatalf("expected a refresh token grant, got %v", grant)
+	}
+
+	var refreshed oidcSession
+	if err := provider.codec.readCookie(newCookieRequest(http.MethodGet, "http://app/", rec.Result().Cookies()), provider.Config.GetCookieName(), &refreshed); err != nil {
+		t.Fatal("no refreshed session cookie: ", err)
+	}
+	if refreshed.Expiry <= time.Now().Unix() || refreshed.Claims.string("refreshed") != "true" {
+		t.Fatalf("session wasn't updated: %+v", refreshed)
+	}
+}
+
+func TestOIDCLogout(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := newTestOIDCProvider(t, issuer)
+	cookies := loginAtMockIssuer(t, issuer, provider)
+
+	// Links and other sites can't log users out
+	rec := httptest.NewRecorder()
+	provider.handle(rec, newCookieRequest(http.MethodGet, "http://app/oauth2/logout", cookies))
+	if rec.Code != http.StatusMethodNotAllowed || len(rec.Result().Cookies()) > 0 {
+		t.Fatalf("expected 405 for GET, got %d", rec.Code)
+	}
+
+	req := newCookieRequest(http.MethodPost, "http://app/oauth2/logout", cookies)
+	req.Header.Set("Origin", "http://evil")
+	rec = httptest.NewRecorder()
+	provider.handle(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a foreign origin, got %d", rec.Code)
+	}
+
+	req = newCookieRequest(http.MethodPost, "http://app/oauth2/logout", cookies)
+	req.Header.Set("Origin", "http://app")
+	rec = httptest.NewRecorder()
+	provider.handle(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", rec.Code)
+	}
+
+	cleared := false
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == provider.Config.GetCookieName() && cookie.MaxAge < 0 {
+			cleared = true
+		}
+	}
+	if !cleared {
+		t.Fatal("session cookie wasn't cleared")
+	}
+
+	target, _ := url.Parse(rec.Header().Get("Location"))
+	if !strings.HasPrefix(target.String(), issuer.URL+"/logout?") {
+		t.Fatalf("expected a redirect to the end session endpoint, got '%s'", target)
+	}
+	query := target.Query()
+	if query.Get("post_logout_redirect_uri") != "http://app/bye" || query.Get("client_id") != "client" {
+		t.Fatalf("unexpected logout query %v", query)
+	}
+
+	claims, err := provider.verifyIDToken(query.Get("id_token_hint"), "")
+	if err != nil || claims.string("sub") != "alice" {
+		t.Fatalf("expected the ID token as hint, got %v", err)
+	}
+}
+
+func TestOIDCCallbackWithoutLocation(t *testing.T) {
+	issuer := newMockIssuer(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.Header.Get("X-User")))
+	}))
+	defer upstream.Close()
+
+	// The route has no location matching the callback path
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		OIDC: &models.OIDCConfig{
+			Issuer:       issuer.URL,
+			ClientID:     "client",
+			ClientSecret: "secret",
+			CookieSecret: "cookie secret",
+			ClaimHeaders: map[string]string{"X-User": "sub"},
+		},
+		Locations: []models.RouteLocation{{Location: "/app/", Destination: upstream.URL + "/"}},
+	})
+	base := "http://" + server.Server[0].ListenAddress.Address
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.Get(base + "/app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	target, _ := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || !strings.HasPrefix(target.String(), issuer.URL+"/authorize?") {
+		t.Fatalf("expected a redirect to the issuer, got %d '%s'", resp.StatusCode, target)
+	}
+	issuer.authorize(target.Query())
+
+	callback := newCookieRequest(http.MethodGet, base+"/oauth2/callback?code=code&state="+url.QueryEscape(target.Query().Get("state")), resp.Cookies())
+	callback.RequestURI = ""
+	resp, err = client.Do(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/app/" {
+		t.Fatalf("expected the callback to be handled, got %d '%s'", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	req := newCookieRequest(http.MethodGet, base+"/app/", resp.Cookies())
+	req.RequestURI = ""
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello alice" {
+		t.Fatalf("expected alice to be logged in, got %d '%s'", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Time a client has to send its ClientHello
+const clientHelloTimeout = 10 * time.Second
+
+// errClientHelloRead aborts the handshake after the ClientHello was read
+var errClientHelloRead = errors.New("client hello read")
+
+// passthrough forwards TLS connections of an SSL address by server name and
+// hands the others to the HTTPS server
+type passthrough struct {
+	address     *models.ListenAddress
+	backends    []*TCPServer
+	fallback    *TCPServer
+	serverNames map[string]bool
+
+	listener  net.Listener
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPassthrough(address *models.ListenAddress, routes []*models.Route) *passthrough {
+	p := &passthrough{
+		address:     address,
+		serverNames: make(map[string]bool),
+		conns:       make(chan net.Conn),
+		done:        make(chan struct{}),
+	}
+
+	for i := range address.Passthrough.Backends {
+		p.backends = append(p.backends, newStreamForwarder(address, &address.Passthrough.Backends[i].Stream))
+	}
+
+	if address.Passthrough.Default != nil {
+		p.fallback = newStreamForwarder(address, address.Passthrough.Default)
+	}
+
+	// Names terminated by the HTTPS server
+	for _, route := range routes {
+		for _, name := range route.ServerNames {
+			p.serverNames[strings.ToLower(name)] = true
+		}
+	}
+
+	return p
+}
+
+// Accept connections of listener. Returns a listener for the connections to
+// be terminated
+func (p *passthrough) listen(listener net.Listener) net.Listener {
+	p.listener = listener
+	go p.serve()
+	return p
+}
+
+func (p *passthrough) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				p.Close()
+				return
+			}
+
+			log.Error("TLS passthrough accept: ", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		go p.route(conn)
+	}
+}
+
+// Route a connection by the server name of its ClientHello
+func (p *passthrough) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(clientHelloTimeout))
+	serverName, hello, err := peekServerName(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		log.Debugf("Can't read ClientHello from %s: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	conn = &peekedConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(hello), conn)}
+
+	for i, backend := range p.address.Passthrough.Backends {
+		if backend.MatchesServerName(serverName) {
+			p.backends[i].forward(conn)
+			return
+		}
+	}
+
+	if p.serverNames[serverName] {
+		select {
+		case p.conns <- conn:
+		case <-p.done:
+			conn.Close()
+		}
+		return
+	}
+
+	if p.fallback != nil {
+		p.fallback.forward(conn)
+		return
+	}
+
+	log.Debugf("Rejecting TLS connection for unknown server name '%s'", serverName)
+	metrics.get(counterMetric, "reverseproxy_tls_passthrough_rejected_total", "TLS connections rejected for unknown server names", "listener", p.address.GetAddress()).add(1)
+	conn.Close()
+}
+
+// Accept implements net.Listener
+func (p *passthrough) Accept() (net.Conn, error) {
+	select {
+	case conn := <-p.conns:
+		return conn, nil
+	case <-p.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener
+func (p *passthrough) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	return p.listener.Close()
+}
+
+// Addr implements net.Listener
+func (p *passthrough) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// Shutdown waits for the forwarded connections until ctx is done
+func (p *passthrough) Shutdown(ctx context.Context) {
+	for _, backend := range p.backends {
+		backend.Shutdown(ctx)
+	}
+	if p.fallback != nil {
+		p.fallback.Shutdown(ctx)
+	}
+}
+
+// Read the ClientHello of conn. Returns the requested server name and the
+// bytes read
+func peekServerName(conn net.Conn) (string, []byte, error) {
+	var hello bytes.Buffer
+	var serverName string
+
+	err := tls.Server(&readOnlyConn{Conn: conn, reader: io.TeeReader(conn, &hello)}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = strings.TrimSuffix(strings.ToLower(info.ServerName), ".")
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+	if !errors.Is(err, errClientHelloRead) {
+		return "", nil, err
+	}
+
+	return serverName, hello.Bytes(), nil
+}
+
+// readOnlyConn a connection which can't be written to. Used to read the
+// ClientHello without responding
+type readOnlyConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+// Read implements io.Reader
+func (conn *readOnlyConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+// Write implements io.Writer
+func (conn *readOnlyConn) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+// peekedConn a connection replaying the bytes read before
+type peekedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+// Read implements io.Reader
+func (conn *peekedConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+// CloseWrite closes the write side of the connection if supported
+func (conn *peekedConn) CloseWrite() error {
+	if !closeWrite(conn.Conn) {
+		return errors.ErrUnsupported
+	}
+	return nil
+}
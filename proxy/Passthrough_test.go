@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Terminate TLS using its own certificate and echo all data. Returns the
+// address and the certificate
+func newTLSEchoServer(t *testing.T) (string, tls.Certificate) {
+	t.Helper()
+
+	cert := testCertificate(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), cert
+}
+
+// Connect to address using serverName and return the connection after the handshake
+func dialPassthrough(address, serverName string) (*tls.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+}
+
+// Send ping over conn and expect it to be echoed
+func expectEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "ping")
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("expected echo, got '%s' %v", reply, err)
+	}
+}
+
+func TestPassthroughMatchesServerName(t *testing.T) {
+	backend := models.PassthroughBackend{ServerNames: []string{"db.example.com", "*.apps.example.com"}}
+
+	tests := map[string]bool{
+		"db.example.com":         true,
+		"DB.Example.com":         true,
+		"web.apps.example.com":   true,
+		"apps.example.com":       false,
+		"a.web.apps.example.com": false,
+		"example.com":            false,
+		"evilapps.example.com":   false,
+		"":                       false,
+	}
+
+	for name, expected := range tests {
+		if backend.MatchesServerName(name) != expected {
+			t.Errorf("%q: expected %v", name, expected)
+		}
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	backendAddress, backendCert := newTLSEchoServer(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "terminated "+r.Host)
+	}))
+	defer upstream.Close()
+
+	server := startTestServer(t, models.ListenAddress{
+		SSL: true,
+		Passthrough: &models.PassthroughData{
+			Backends: []models.PassthroughBackend{{
+				ServerNames: []string{"*.backend.test"},
+				Stream:      models.StreamData{Upstreams: []string{backendAddress}},
+			}},
+		},
+	}, &models.Route{
+		ServerNames: []string{"localhost"},
+		Locations:   []models.RouteLocation{{Location: "/", Destination: upstream.URL + "/"}},
+	})
+	address := server.Server[0].ListenAddress.Address
+
+	// Backend names are forwarded without terminating TLS
+	conn, err := dialPassthrough(address, "app.backend.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !bytes.Equal(conn.ConnectionState().PeerCertificates[0].Raw, backendCert.Leaf.Raw) {
+		t.Fatal("TLS wasn't terminated by the backend")
+	}
+	expectEcho(t, conn)
+
+	// Names of routes are terminated by the proxy
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: testCertPool(&server.Server[0]), ServerName: "localhost"},
+	}}
+	defer client.CloseIdleConnections()
+
+	req, _ := http.NewRequest(http.MethodGet, "https://"+address+"/", nil)
+	req.Host = "localhost"
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "terminated localhost" {
+		t.Fatalf("unexpected response %d '%s'", resp.StatusCode, body)
+	}
+
+	// Other names are rejected
+	if conn, err := dialPassthrough(address, "unknown.test"); err == nil {
+		conn.Close()
+		t.Fatal("expected a connection for an unknown server name to be rejected")
+	}
+}
+
+func TestPassthroughDefault(t *testing.T) {
+	backendAddress, _ := newTLSEchoServer(t)
+	defaultAddress, defaultCert := newTLSEchoServer(t)
+
+	server := startTestServer(t, models.ListenAddress{
+		SSL: true,
+		Passthrough: &models.PassthroughData{
+			Backends: []models.PassthroughBackend{{
+				ServerNames: []string{"db.test"},
+				Stream:      models.StreamData{Upstreams: []string{backendAddress}},
+			}},
+			Default: &models.StreamData{Upstreams: []string{defaultAddress}},
+		},
+	})
+	address := server.Server[0].ListenAddress.Address
+
+	// Unknown names and clients without SNI use the default upstreams
+	for _, serverName := range []string{"unknown.test", ""} {
+		conn, err := dialPassthrough(address, serverName)
+		if err != nil {
+			t.Fatalf("%q: %s", serverName, err)
+		}
+		if !bytes.Equal(conn.ConnectionState().PeerCertificates[0].Raw, defaultCert.Leaf.Raw) {
+			t.Fatalf("%q: expected the default upstream", serverName)
+		}
+		expectEcho(t, conn)
+		conn.Close()
+	}
+}
+
+func TestPeekServerName(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: "Example.COM.", InsecureSkipVerify: true}).Handshake()
+		client.Close()
+	}()
+
+	serverName, hello, err := peekServerName(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverName != "example.com" {
+		t.Fatalf("expected example.com, got %q", serverName)
+	}
+
+	// The peeked bytes are replayed before the rest of the connection
+	conn := &peekedConn{Conn: server, reader: io.MultiReader(bytes.NewReader(hello), server)}
+	replayed := make([]byte, len(hello))
+	if _, err := io.ReadFull(conn, replayed); err != nil || !bytes.Equal(replayed, hello) || replayed[0] != 0x16 {
+		t.Fatalf("ClientHello wasn't replayed: %v", err)
+	}
+}
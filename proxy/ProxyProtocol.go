@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/pires/go-proxyproto"
+)
+
+// Transports sending PROXY protocol headers by version
+var proxyProtocolTransports = map[int]*http.Transport{
+	1: newProxyProtocolTransport(1),
+	2: newProxyProtocolTransport(2),
+}
+
+// Context key of the client and local address sent in PROXY protocol headers
+type proxyProtocolAddrsKey struct{}
+
+// Read the client address of connections from trusted load balancers from
+// PROXY protocol headers
+func proxyProtocolListener(listener net.Listener, config *models.ProxyProtocolConfig) net.Listener {
+	return &proxyproto.Listener{
+		Listener:          listener,
+		ReadHeaderTimeout: config.GetHeaderTimeout(),
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			// Don't parse headers of untrusted clients
+			if !config.IsTrusted(net.ParseIP(stripPort(upstream.String()))) {
+				return proxyproto.SKIP, nil
+			}
+
+			if config.Require {
+				return proxyproto.REQUIRE, nil
+			}
+			return proxyproto.USE, nil
+		},
+	}
+}
+
+// Write a PROXY protocol header of version containing the client address
+// source and the address destination it connected to
+func writeProxyHeader(conn net.Conn, version int, source, destination net.Addr) error {
+	_, err := proxyproto.HeaderProxyFromAddrs(byte(version), source, destination).WriteTo(conn)
+	return err
+}
+
+// Create a transport writing a PROXY protocol header to each new connection.
+// Connections aren't reused, since the header belongs to a single client
+func newProxyProtocolTransport(version int) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, _ := ctx.Value(proxyProtocolAddrsKey{}).([2]net.Addr)
+		if err := writeProxyHeader(conn, version, addrs[0], addrs[1]); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+
+	return transport
+}
+
+// Return the transport sending PROXY protocol headers of version and the
+// request carrying the addresses of its client
+func withProxyProtocol(req *http.Request, version int) (*http.Request, http.RoundTripper) {
+	var addrs [2]net.Addr
+
+	// HTTP/3 clients use UDP
+	if source, err := net.ResolveTCPAddr("tcp", req.RemoteAddr); err == nil {
+		addrs[0] = source
+	}
+	if local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if destination, err := net.ResolveTCPAddr("tcp", local.String()); err == nil {
+			addrs[1] = destination
+		}
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), proxyProtocolAddrsKey{}, addrs)), proxyProtocolTransports[version]
+}
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/pires/go-proxyproto"
+)
+
+// proxyProtocolResult a connection accepted by a proxyProtocolListener
+type proxyProtocolResult struct {
+	remoteAddr string
+	data       string
+	err        error
+	duration   time.Duration
+}
+
+// Accept a single connection using proxyProtocolListener and read its first bytes
+func acceptProxyProtocol(t *testing.T, config *models.ProxyProtocolConfig) (string, <-chan proxyProtocolResult) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener = proxyProtocolListener(listener, config)
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	results := make(chan proxyProtocolResult, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			results <- proxyProtocolResult{err: err}
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		start := time.Now()
+		data := make([]byte, 5)
+		_, err = io.ReadFull(conn, data)
+		results <- proxyProtocolResult{remoteAddr: conn.RemoteAddr().String(), data: string(data), err: err, duration: time.Since(start)}
+	}()
+
+	return listener.Addr().String(), results
+}
+
+// Connect to address and send a PROXY protocol header for source (if set) and data
+func sendProxyProtocol(t *testing.T, address string, source *net.TCPAddr, data string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	if source != nil {
+		destination, _ := net.ResolveTCPAddr("tcp", address)
+		if err := writeProxyHeader(conn, 1, source, destination); err != nil {
+			t.Fatal(err)
+		}
+	}
+	io.WriteString(conn, data)
+	return conn
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242}
+
+	// Trusted load balancers set the client address
+	address, results := acceptProxyProtocol(t, &models.ProxyProtocolConfig{TrustedIPs: []string{"127.0.0.1"}})
+	sendProxyProtocol(t, address, client, "hello")
+	if res := <-results; res.err != nil || res.remoteAddr != "203.0.113.7:4242" || res.data != "hello" {
+		t.Fatalf("expected the address of the header, got %+v", res)
+	}
+
+	// Headers of other clients aren't parsed, so they can't spoof their address
+	address, results = acceptProxyProtocol(t, &models.ProxyProtocolConfig{TrustedIPs: []string{"10.0.0.0/8"}})
+	sendProxyProtocol(t, address, client, "hello")
+	if res := <-results; res.err != nil || strings.HasPrefix(res.remoteAddr, "203.0.113.7") || res.data != "PROXY" {
+		t.Fatalf("expected the header of an untrusted client to be ignored, got %+v", res)
+	}
+
+	// Trusted connections without header are allowed unless required
+	address, results = acceptProxyProtocol(t, &models.ProxyProtocolConfig{TrustedIPs: []string{"127.0.0.1"}})
+	sendProxyProtocol(t, address, nil, "hello")
+	if res := <-results; res.err != nil || !strings.HasPrefix(res.remoteAddr, "127.0.0.1:") || res.data != "hello" {
+		t.Fatalf("expected a connection without header, got %+v", res)
+	}
+
+	address, results = acceptProxyProtocol(t, &models.ProxyProtocolConfig{TrustedIPs: []string{"127.0.0.1"}, Require: true})
+	sendProxyProtocol(t, address, nil, "hello")
+	if res := <-results; res.err == nil {
+		t.Fatalf("expected a connection without required header to fail, got %+v", res)
+	}
+}
+
+func TestProxyProtocolHeaderTimeout(t *testing.T) {
+	address, results := acceptProxyProtocol(t, &models.ProxyProtocolConfig{
+		TrustedIPs:    []string{"127.0.0.1"},
+		HeaderTimeout: models.ConfigDuration(100 * time.Millisecond),
+		Require:       true,
+	})
+
+	// Send nothing
+	sendProxyProtocol(t, address, nil, "")
+	res := <-results
+	if res.err == nil || res.duration > 2*time.Second {
+		t.Fatalf("expected the header timeout to close the connection, got %+v", res)
+	}
+}
+
+func TestWriteProxyHeader(t *testing.T) {
+	source := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242}
+	destination := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 443}
+
+	for _, version := range []int{1, 2} {
+		client, server := net.Pipe()
+		go func() {
+			writeProxyHeader(client, version, source, destination)
+			client.Close()
+		}()
+
+		header, err := proxyproto.Read(bufio.NewReader(server))
+		server.Close()
+		if err != nil {
+			t.Fatalf("v%d: %s", version, err)
+		}
+		if int(header.Version) != version || header.SourceAddr.String() != source.String() || header.DestinationAddr.String() != destination.String() {
+			t.Fatalf("v%d: unexpected header %+v", version, header)
+		}
+	}
+}
+
+func TestSendProxyProtocol(t *testing.T) {
+	// The upstream reads the client address from the header
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	})}
+	go upstream.Serve(&proxyproto.Listener{Listener: listener, Policy: func(net.Addr) (proxyproto.Policy, error) {
+		return proxyproto.REQUIRE, nil
+	}})
+	defer upstream.Close()
+
+	for _, version := range []int{1, 2} {
+		server := startTestServer(t, models.ListenAddress{}, &models.Route{
+			ServerNames: []string{"127.0.0.1"},
+			Locations:   []models.RouteLocation{{Location: "/", Destination: "http://" + listener.Addr().String() + "/", SendProxyProtocol: version}},
+		})
+
+		// Remember the address of the client
+		var clientAddr string
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+				if err == nil {
+					clientAddr = conn.LocalAddr().String()
+				}
+				return conn, err
+			},
+		}}
+
+		resp, err := client.Get("http://" + server.Server[0].ListenAddress.Address + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		client.CloseIdleConnections()
+
+		if resp.StatusCode != http.StatusOK || string(body) != clientAddr {
+			t.Fatalf("v%d: expected the upstream to see %s, got %d '%s'", version, clientAddr, resp.StatusCode, body)
+		}
+	}
+}
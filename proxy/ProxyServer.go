@@ -2,11 +2,15 @@ package proxy
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"net/http"
 	"net/http/httputil"
 
 	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // HTTPServer http server
@@ -17,7 +21,17 @@ type HTTPServer struct {
 	Routes        []*models.Route
 	Server        *http.Server
 	Config        *models.Config
+	Caches        map[*models.RouteLocation]*ResponseCache
+	Auths         map[*models.RouteLocation]*Authenticator
+	OIDC          map[*models.OIDCConfig]*OIDCProvider
+	ClientCAs     map[*models.ClientCertConfig]*x509.CertPool
+	AccessLog     *AccessLog
+	HTTP3         *http3.Server
 	Loglevel      log.Level
+
+	proxy       *httputil.ReverseProxy
+	webSockets  *webSocketRegistry
+	passthrough *passthrough
 }
 
 // Start starts the server
@@ -28,11 +42,30 @@ func (httpServer *HTTPServer) Start() {
 }
 
 func (httpServer *HTTPServer) initRouter() {
-	httpServer.Server.Handler = &httputil.ReverseProxy{
+	httpServer.proxy = &httputil.ReverseProxy{
 		Director:       httpServer.Director,
 		Transport:      httpServer,
 		ModifyResponse: httpServer.ModifyResponse,
 	}
+	httpServer.webSockets = newWebSocketRegistry()
+	httpServer.Server.Handler = httpServer
+
+	// Accept HTTP/2 without TLS for gRPC clients
+	if !httpServer.SSL && httpServer.ListenAddress.H2C {
+		httpServer.Server.Handler = h2c.NewHandler(httpServer, &http2.Server{
+			IdleTimeout: httpServer.Config.Server.GetIdleTimeout(),
+		})
+	}
+
+	// Forward TLS connections of some server names without terminating them
+	if httpServer.SSL && httpServer.ListenAddress.Passthrough != nil {
+		httpServer.passthrough = newPassthrough(httpServer.ListenAddress, httpServer.Routes)
+	}
+
+	// Serve HTTP/3 using the same certificates
+	if httpServer.SSL && httpServer.ListenAddress.HTTP3 && !httpServer.ListenAddress.IsUnix() {
+		httpServer.initHTTP3()
+	}
 }
 
 // Start the server
@@ -44,21 +77,46 @@ func (httpServer *HTTPServer) run() {
 			len(httpServer.Routes),
 		)
 
-		// Create TLS Listener for ... tls
-		listener, err := tls.Listen("tcp", httpServer.Server.Addr, httpServer.Server.TLSConfig)
+		listener, err := listen(httpServer.ListenAddress)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		// Start the server
-		log.Fatal(httpServer.Server.Serve(listener))
+		// Route connections by server name first
+		if httpServer.passthrough != nil {
+			listener = httpServer.passthrough.listen(listener)
+		}
+
+		// Create TLS Listener for ... tls
+		listener = tls.NewListener(listener, httpServer.Server.TLSConfig)
+
+		// Start the HTTP/3 server
+		if httpServer.HTTP3 != nil {
+			go func() {
+				if err := httpServer.HTTP3.ListenAndServe(); err != http.ErrServerClosed {
+					log.Fatal(err)
+				}
+			}()
+		}
+
+		// Start the server. Returns ErrServerClosed after a shutdown
+		if err := httpServer.Server.Serve(listener); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
 	} else {
 		log.Debugf("Starting HTTP server on '%s' with %d routes",
 			httpServer.Server.Addr,
 			len(httpServer.Routes),
 		)
 
+		listener, err := listen(httpServer.ListenAddress)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		// Start the http server
-		log.Fatalln(httpServer.Server.ListenAndServe())
+		if err := httpServer.Server.Serve(listener); err != http.ErrServerClosed {
+			log.Fatalln(err)
+		}
 	}
 }
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Return a port of localhost which isn't in use
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// Create a self signed certificate for localhost
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+// Return a pool trusting the certificate of an SSL server
+func testCertPool(server *HTTPServer) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Server.TLSConfig.Certificates[0].Leaf)
+	return pool
+}
+
+// Start a server for address on a free port of localhost like InitHTTPServers
+// does, including the caches, authenticators and client CAs of the routes.
+// SSL addresses use a certificate of testCertificate. The server gets shut
+// down at the end of the test
+func startTestServer(t *testing.T, address models.ListenAddress, routes ...*models.Route) *ReverseProxyServer {
+	t.Helper()
+
+	config := &models.Config{}
+	server := &ReverseProxyServer{Config: config}
+	for _, route := range routes {
+		server.Routes = append(server.Routes, *route)
+	}
+
+	var serverRoutes []*models.Route
+	for i := range server.Routes {
+		route := &server.Routes[i]
+		for j := range route.Locations {
+			route.Locations[j].Init(route)
+			if route.Locations[j].Location == "/" {
+				route.DefaultLocation = &route.Locations[j]
+			}
+		}
+		serverRoutes = append(serverRoutes, route)
+	}
+	server.initCaches()
+	server.initAuths()
+	server.initClientCAs()
+
+	address.Address = "127.0.0.1:" + freePort(t)
+	httpServer := &http.Server{Addr: address.Address}
+	if address.SSL {
+		httpServer.TLSConfig = &tls.Config{
+			NextProtos:   []string{"h2", "http/1.1"},
+			Certificates: []tls.Certificate{testCertificate(t)},
+		}
+		server.clientCertTLSConfigs(httpServer.TLSConfig, serverRoutes)
+	}
+
+	server.Server = []HTTPServer{{
+		SSL:           address.SSL,
+		Server:        httpServer,
+		Routes:        serverRoutes,
+		Config:        config,
+		Caches:        server.Caches,
+		Auths:         server.Auths,
+		OIDC:          server.OIDC,
+		ClientCAs:     server.ClientCAs,
+		ListenAddress: &address,
+	}}
+	server.Server[0].Start()
+
+	// Wait for the listener
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", address.Address)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Cleanup(func() {
+		// Shutdown waits for unused connections of clients
+		http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+
+	return server
+}
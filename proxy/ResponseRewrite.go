@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// headerRewriter maps URLs and cookies of an upstream response to the public URL of a request
+type headerRewriter struct {
+	req      *http.Request
+	location *models.RouteLocation
+	config   models.ResponseRewrite
+
+	// URL of the request as seen by the client
+	public *url.URL
+	// URL the request was forwarded to
+	upstream *url.URL
+
+	publicPrefix   string
+	upstreamPrefix string
+}
+
+// Create a headerRewriter for the response of an upstream request
+func newHeaderRewriter(upstreamReq *http.Request, rc *requestContext) *headerRewriter {
+	rewriter := &headerRewriter{
+		req:      upstreamReq,
+		location: rc.Location,
+		public:   rc.PublicURL,
+		upstream: upstreamReq.URL,
+	}
+
+	if rc.Location.Rewrite != nil {
+		rewriter.config = *rc.Location.Rewrite
+	}
+
+	rewriter.publicPrefix, rewriter.upstreamPrefix = splitCommonSuffix(rc.PublicURL.Path, upstreamReq.URL.Path)
+	return rewriter
+}
+
+// Split two paths into their differing prefixes, cut at a segment boundary
+func splitCommonSuffix(public, upstream string) (string, string) {
+	i, j := len(public), len(upstream)
+	for i > 0 && j > 0 && public[i-1] == upstream[j-1] {
+		i--
+		j--
+	}
+
+	// The common part has to start with a slash
+	for i < len(public) && public[i] != '/' {
+		i++
+		j++
+	}
+
+	return public[:i], upstream[:j]
+}
+
+// Return true if p is prefix or a subpath of prefix
+func hasPathPrefix(p, prefix string) bool {
+	if len(prefix) == 0 || p == prefix {
+		return true
+	}
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(p, prefix)
+	}
+	return strings.HasPrefix(p, prefix+"/")
+}
+
+// Return the host of u including the default port of its scheme
+func hostWithPort(u *url.URL) string {
+	if len(u.Port()) > 0 {
+		return strings.ToLower(u.Host)
+	}
+
+	port := "80"
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		port = "443"
+	}
+	return strings.ToLower(u.Hostname()) + ":" + port
+}
+
+// Rewrite the URL of a Location, Content-Location or Refresh header
+func (rewriter *headerRewriter) rewriteURL(raw string) string {
+	// Explicit rules
+	for _, rule := range rewriter.config.Redirects {
+		if rule.MatchPrefix(raw) {
+			return expandVariables(rule.To, rewriter.req, rewriter.location) + raw[len(rule.From):]
+		}
+	}
+
+	if rewriter.config.DisableRedirects {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	if len(u.Host) > 0 {
+		// Only rewrite URLs pointing to the destination
+		if hostWithPort(u) != hostWithPort(rewriter.upstream) {
+			return raw
+		}
+	} else if len(u.Scheme) > 0 || !strings.HasPrefix(u.Path, "/") || rewriter.publicPrefix == rewriter.upstreamPrefix {
+		return raw
+	}
+
+	// Map the path of the upstream to the public one
+	if hasPathPrefix(u.Path, rewriter.upstreamPrefix) {
+		u.Path = rewriter.publicPrefix + strings.TrimPrefix(u.Path, rewriter.upstreamPrefix)
+		if !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path
+		}
+		u.RawPath = ""
+	}
+
+	if len(u.Host) > 0 {
+		u.Scheme = rewriter.public.Scheme
+		u.Host = rewriter.public.Host
+	}
+
+	return u.String()
+}
+
+// Rewrite the URL part of a Refresh header like '5; url=/new'
+func (rewriter *headerRewriter) rewriteRefresh(value string) string {
+	index := strings.Index(strings.ToLower(value), "url=")
+	if index < 0 {
+		return value
+	}
+
+	target := strings.TrimSpace(value[index+4:])
+	quote := ""
+	if len(target) > 1 && (target[0] == '\'' || target[0] == '"') && target[len(target)-1] == target[0] {
+		quote = target[:1]
+		target = target[1 : len(target)-1]
+	}
+
+	return value[:index+4] + quote + rewriter.rewriteURL(target) + quote
+}
+
+// Rewrite Domain and Path attributes of a Set-Cookie header
+func (rewriter *headerRewriter) rewriteCookie(value string) string {
+	parts := strings.Split(value, ";")
+	result := parts[:1]
+
+	for _, part := range parts[1:] {
+		attr := strings.TrimSpace(part)
+		lowerAttr := strings.ToLower(attr)
+
+		switch {
+		case strings.HasPrefix(lowerAttr, "domain="):
+			domain := attr[len("domain="):]
+			for _, rule := range rewriter.config.CookieDomains {
+				if rule.MatchDomain(domain) {
+					domain = expandVariables(rule.To, rewriter.req, rewriter.location)
+					break
+				}
+			}
+
+			// Remove the attribute to make it a host-only cookie
+			if len(domain) == 0 {
+				continue
+			}
+			attr = "Domain=" + domain
+		case strings.HasPrefix(lowerAttr, "path="):
+			path := attr[len("path="):]
+			for _, rule := range rewriter.config.CookiePaths {
+				if rule.MatchPrefix(path) {
+					path = expandVariables(rule.To, rewriter.req, rewriter.location) + path[len(rule.From):]
+					break
+				}
+			}
+			if len(path) == 0 {
+				path = "/"
+			}
+			attr = "Path=" + path
+		}
+
+		result = append(result, " "+attr)
+	}
+
+	return strings.Join(result, ";")
+}
+
+// Rewrite all headers of a response
+func (rewriter *headerRewriter) rewrite(header http.Header) {
+	for _, name := range []string{"Location", "Content-Location"} {
+		if value := header.Get(name); len(value) > 0 {
+			header.Set(name, rewriter.rewriteURL(value))
+		}
+	}
+
+	if value := header.Get("Refresh"); len(value) > 0 {
+		header.Set("Refresh", rewriter.rewriteRefresh(value))
+	}
+
+	if len(rewriter.config.CookieDomains) > 0 || len(rewriter.config.CookiePaths) > 0 {
+		cookies := header.Values("Set-Cookie")
+		for i := range cookies {
+			cookies[i] = rewriter.rewriteCookie(cookies[i])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseWriter wraps a http.ResponseWriter to modify the header right before
+// it gets written and to keep track of the status code and written bytes
+type responseWriter struct {
+	http.ResponseWriter
+	beforeWrite func(header http.Header, status int)
+	// Content type of gRPC calls. Error responses are converted into gRPC errors
+	grpcContentType string
+
+	discardBody bool
+
+	wroteHeader bool
+	status      int
+	written     int64
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *responseWriter) WriteHeader(status int) {
+	// Informational responses are sent without modifications
+	if !w.wroteHeader && status >= 200 {
+		w.wroteHeader = true
+		w.status = status
+		if w.beforeWrite != nil {
+			w.beforeWrite(w.Header(), status)
+		}
+
+		// gRPC clients expect errors as status 200 with a grpc-status
+		if len(w.grpcContentType) > 0 && status != http.StatusOK && len(w.Header().Get("Grpc-Status")) == 0 {
+			setGRPCErrorHeader(w.Header(), status, w.grpcContentType)
+			w.discardBody = true
+			w.ResponseWriter.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.discardBody {
+		return len(b), nil
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Unwrap returns the original http.ResponseWriter. Used by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack implements http.Hijacker. Hijacked connections are logged as
+// 101 Switching Protocols
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
@@ -6,11 +6,6 @@ import (
 	"net/http"
 )
 
-// Get 403 forbidden response
-func getForbiddenResponse(req *http.Request) *http.Response {
-	return buildResponse(req, http.StatusForbidden, "403 Forbidden", "403 Forbidden", nil)
-}
-
 // Build http response
 func buildResponse(req *http.Request, statusCode int, body, status string, header http.Header) *http.Response {
 	response := http.Response{
@@ -2,8 +2,10 @@ package proxy
 
 import (
 	"errors"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/JojiiOfficial/ReverseProxy/models"
@@ -12,24 +14,30 @@ import (
 
 // ModifyResponse modifies the response from redirected request to client
 func (httpServer *HTTPServer) ModifyResponse(r *http.Response) error {
-	// Change Moved permanently locations to SSL
+	// Map headers pointing to the destination to the public URL
+	originalLocation := r.Header.Get("Location")
+	if rc := getRequestContext(r.Request); rc.Location != nil && rc.PublicURL != nil {
+		newHeaderRewriter(r.Request, rc).rewrite(r.Header)
+	}
+
+	// Change redirect locations to SSL if they weren't mapped already
 	location, ok := r.Header["Location"]
-	if ok && len(location) > 0 && r.StatusCode == http.StatusMovedPermanently {
+	if ok && len(location) > 0 && location[0] == originalLocation && r.StatusCode >= 300 && r.StatusCode < 400 {
 		u, err := url.Parse(location[0])
 		if err != nil {
 			return err
 		}
 
 		// Only change Location header if location is assigned to the server
-		if route := models.GetRouteForHost(httpServer.Routes, u.Hostname()); route != nil {
+		sslAddress := httpServer.Config.GetPreferredSSLAddress()
+		if route := models.GetRouteForHost(httpServer.Routes, u.Hostname()); route != nil && sslAddress != nil {
 			// Upgrade to https location
 			if u.Scheme == "http" {
 				u.Scheme = "https"
 
 				// Change port
-				sslPort := httpServer.Config.GetPreferredSSLAddress()
-				if u.Port() != sslPort.GetPort() {
-					u.Host = u.Hostname() + ":" + sslPort.GetPort()
+				if u.Port() != sslAddress.GetPort() {
+					u.Host = u.Hostname() + ":" + sslAddress.GetPort()
 				}
 			}
 
@@ -41,6 +49,117 @@ func (httpServer *HTTPServer) ModifyResponse(r *http.Response) error {
 	return nil
 }
 
+// ServeHTTP finds the location of a request and handles it
+func (httpServer *HTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.URL.Host = req.Host
+
+	rc := &requestContext{
+		RequestID: getRequestID(req),
+		StartTime: time.Now(),
+	}
+	rw := &responseWriter{ResponseWriter: w, grpcContentType: grpcContentType(req)}
+	w = rw
+
+	// Log the request after it has been handled
+	if httpServer.AccessLog != nil {
+		defer httpServer.AccessLog.write(req, rc, rw)
+	}
+
+	labels := []string{"listener", httpServer.ListenAddress.Address, "protocol", req.Proto}
+	metrics.get(counterMetric, "reverseproxy_requests_total", "Handled requests", labels...).add(1)
+	activeRequests := metrics.get(gaugeMetric, "reverseproxy_active_requests", "Requests currently being handled", labels...)
+	activeRequests.add(1)
+	defer activeRequests.add(-1)
+
+	if httpServer.HTTP3 != nil {
+		httpServer.handleHTTP3(w, req, rc.StartTime)
+	}
+
+	// Redirect everything except configured paths
+	redirectData := httpServer.ListenAddress.TaskData.Redirect
+	if httpServer.ListenAddress.IsRedirectInterface && !redirectData.IsException(req.URL.Path) {
+		httpServer.redirectTask(w, req, httpServer.ListenAddress)
+		return
+	}
+
+	// Second redirect of HSTSFriendly redirect addresses
+	if req.TLS != nil && httpServer.canonicalHostRedirect(w, req) {
+		return
+	}
+
+	publicURL := *req.URL
+	publicURL.Scheme = requestScheme(req)
+	rc.PublicURL = &publicURL
+	req = withRequestContext(req, rc)
+
+	// Handle the login callback and logout of the route. They don't belong to
+	// a location, so the checks of the locations don't apply
+	if route := models.FindRouteForServerName(httpServer.Routes, req.URL.Hostname()); route != nil && route.OIDC != nil {
+		if provider, ok := httpServer.OIDC[route.OIDC]; ok && provider.handle(w, req) {
+			return
+		}
+	}
+
+	// Find location
+	location := models.FindMatchingLocation(httpServer.Routes, req)
+	rc.Location = location
+
+	if location != nil {
+		// Modify response headers right before they get written
+		rw.beforeWrite = func(header http.Header, status int) {
+			applySecurityHeaders(header, location.SecurityPolicy, httpServer.SSL)
+			if location.CORS != nil {
+				applyCORSHeaders(header, req, location.CORS)
+			}
+			modifyResponseHeader(header, req, location)
+		}
+
+		// Answer CORS preflight requests without the upstream
+		if location.CORS != nil && isPreflightRequest(req) {
+			httpServer.corsPreflight(w, req, location)
+			return
+		}
+
+		// Verify client certificates
+		if !httpServer.checkClientCert(w, req, location) {
+			return
+		}
+
+		// Verify signed URLs
+		if location.SignedURL != nil && !checkSignedURL(w, req, location) {
+			return
+		}
+
+		// Handle access control and authentication
+		if !httpServer.checkAccess(w, req, location) {
+			return
+		}
+
+		switch location.GetAction() {
+		case models.RedirectAction:
+			httpServer.redirectAction(w, req, location)
+			return
+		case models.RespondAction:
+			httpServer.respondAction(w, req, location)
+			return
+		}
+
+		// Serve local files
+		if location.Static != nil {
+			httpServer.staticTask(w, req, location)
+			return
+		}
+
+		// Proxy WebSocket connections without the timeouts of the server
+		if isWebSocketUpgrade(req) {
+			httpServer.webSocketTask(w, req, location)
+			return
+		}
+	}
+
+	httpServer.proxy.ServeHTTP(w, req)
+}
+
 // Director directs
 func (httpServer *HTTPServer) Director(req *http.Request) {}
 
@@ -54,24 +173,17 @@ func (httpServer *HTTPServer) RoundTrip(req *http.Request) (*http.Response, erro
 
 	// Set host of new request
 	req.URL.Host = req.Host
-	var err error
-	taskResponse := new(http.Response)
 
-	if httpServer.ListenAddress.IsRedirectInterface {
-		// Handle Redirection
-		taskResponse = httpServer.redirectTask(req, httpServer.ListenAddress)
-	} else {
-		// Handle proxy route
-		location := models.FindMatchingLocation(httpServer.Routes, req)
-		if location == nil {
-			log.Warnf("No matching route found for %s", req.URL.String())
-			return nil, errors.New("Route not found")
-		}
-
-		// Do response
-		taskResponse, err = httpServer.proxyTask(req, location)
+	// Handle proxy route
+	location := getRequestContext(req).Location
+	if location == nil {
+		log.Warnf("No matching route found for %s", req.URL.String())
+		return nil, errors.New("Route not found")
 	}
 
+	// Do response
+	taskResponse, err := httpServer.proxyTask(req, location)
+
 	// Prevent useless operations
 	if httpServer.Loglevel == log.DebugLevel {
 		// Print stats
@@ -85,35 +197,143 @@ func (httpServer *HTTPServer) RoundTrip(req *http.Request) (*http.Response, erro
 
 // Proxy a request
 func (httpServer *HTTPServer) proxyTask(req *http.Request, location *models.RouteLocation) (*http.Response, error) {
+	// Decompress request bodies for upstreams which can't handle them
+	if location.Compression != nil && location.Compression.DecompressRequests {
+		if err := decompressRequest(req); err != nil {
+			log.Debug("Can't decompress request: ", err)
+			return buildResponse(req, http.StatusBadRequest, "400 Bad Request", "400 Bad Request", nil), nil
+		}
+	}
+
+	var resp *http.Response
+	var err error
+
+	// Use the cache of the location if available
+	if cache, ok := httpServer.Caches[location]; ok {
+		resp, err = cache.RoundTrip(req, cacheKey(req.Host, req.URL.RequestURI()), func(outreq *http.Request) (*http.Response, error) {
+			return httpServer.forward(outreq, location)
+		})
+	} else {
+		resp, err = httpServer.forward(req, location)
+	}
+
+	// Compress the response
+	if err == nil && location.Compression != nil {
+		resp = compressResponse(req, resp, location.Compression)
+	}
+
+	return resp, err
+}
+
+// Forward a request to the destination of a location
+func (httpServer *HTTPServer) forward(req *http.Request, location *models.RouteLocation) (*http.Response, error) {
+	// FastCGI applications get the request as CGI params
+	if location.FastCGI != nil {
+		modifyRequestHeader(req, location)
+		return forwardFastCGI(req, location)
+	}
+
 	// Modifies the request
 	location.ModifyProxyRequest(req)
+	modifyRequestHeader(req, location)
 	log.Debug("Destination: -> ", req.URL)
 
-	// Handle access control
-	if !isRequestAllowed(req, location) {
-		log.Debugf("IP %s is not allowed", req.RemoteAddr)
-		return getForbiddenResponse(req), nil
+	// Translate gRPC-Web calls
+	if location.GRPCWeb != nil && isGRPCWebRequest(req) {
+		return forwardGRPCWeb(req)
 	}
 
-	// Call default roundTrip to forward the request
-	return http.DefaultTransport.RoundTrip(req)
+	// Connect to HTTP servers on unix sockets
+	if len(location.UnixSocket) > 0 {
+		return unixTransport(location.UnixSocket).RoundTrip(req)
+	}
+
+	// Send the client address in a PROXY protocol header
+	if location.SendProxyProtocol > 0 {
+		req, transport := withProxyProtocol(req, location.SendProxyProtocol)
+		return transport.RoundTrip(req)
+	}
+
+	// Use HTTP/2 for h2c and gRPC upstreams
+	return upstreamTransport(req).RoundTrip(req)
 }
 
 // Send redirect request
-func (httpServer *HTTPServer) redirectTask(req *http.Request, listenAddress *models.ListenAddress) *http.Response {
-	body := listenAddress.TaskData.Redirect.GetBody()
-	req.URL.Scheme = "https"
-	to := req.URL.String()
+func (httpServer *HTTPServer) redirectTask(w http.ResponseWriter, req *http.Request, listenAddress *models.ListenAddress) {
+	redirectData := listenAddress.TaskData.Redirect
+
+	// HSTSFriendly redirects to the requested host first. The SSL server
+	// redirects to the canonical host afterwards
+	hostname := req.URL.Hostname()
+	if len(redirectData.Host) > 0 && !redirectData.HSTSFriendly {
+		hostname = redirectData.Host
+	}
+
+	if len(hostname) == 0 {
+		log.Debugf("No redirect target for %s", req.URL.String())
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Use the port of the preferred SSL address
+	port := redirectData.Port
+	if len(port) == 0 {
+		if sslAddress := httpServer.Config.GetPreferredSSLAddress(); sslAddress != nil {
+			port = sslAddress.GetPort()
+		}
+	}
+
+	writeRedirect(w, req, redirectData, hostname, port)
+}
 
-	if len(to) == 0 {
-		log.Fatalln("To redirect target specified for %s")
-		return nil
+// Redirect HTTPS requests for other server names of the route of the canonical
+// host of a HSTSFriendly redirect address to the canonical host. Returns true
+// if the request was redirected
+func (httpServer *HTTPServer) canonicalHostRedirect(w http.ResponseWriter, req *http.Request) bool {
+	hostname := req.URL.Hostname()
+	for _, address := range httpServer.Config.ListenAddresses {
+		redirectData := address.TaskData.Redirect
+		if address.GetTask() != models.HTTPRedirectTask || !redirectData.HSTSFriendly || len(redirectData.Host) == 0 || strings.EqualFold(hostname, redirectData.Host) {
+			continue
+		}
+
+		route := models.FindRouteForServerName(httpServer.Routes, strings.ToLower(redirectData.Host))
+		if route == nil || !matchesServerName(route, hostname) {
+			continue
+		}
+
+		// Keep the port the client connected to
+		_, port, _ := net.SplitHostPort(req.Host)
+		writeRedirect(w, req, redirectData, redirectData.Host, port)
+		return true
+	}
+
+	return false
+}
+
+// Redirect a request to the same path on hostname and port using https
+func writeRedirect(w http.ResponseWriter, req *http.Request, redirectData models.RedirectData, hostname, port string) {
+	host := hostname
+	if len(port) > 0 && port != "443" {
+		host = net.JoinHostPort(hostname, port)
+	} else if strings.Contains(hostname, ":") {
+		host = "[" + hostname + "]"
 	}
 
-	// Build header
-	header := make(http.Header)
-	header.Set("Location", to)
+	target := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     req.URL.Path,
+		RawPath:  req.URL.RawPath,
+		RawQuery: req.URL.RawQuery,
+	}
 
-	// Build and return response
-	return buildResponse(req, http.StatusMovedPermanently, body, "301 Moved permanently", header)
+	// Write response
+	code := redirectData.GetHTTPCode()
+	w.Header().Set("Location", target.String())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	if req.Method != http.MethodHead {
+		w.Write([]byte(redirectData.GetBody()))
+	}
 }
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Return a server handling the redirect address of config
+func newRedirectTestServer(config *models.Config) *HTTPServer {
+	for i := range config.ListenAddresses {
+		config.ListenAddresses[i].Init()
+	}
+	return &HTTPServer{Config: config, ListenAddress: &config.ListenAddresses[0]}
+}
+
+func TestRedirectTask(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect models.RedirectData
+		target   string
+		code     int
+		location string
+	}{
+		{"ssl port", models.RedirectData{}, "http://example.com/a%2Fb?x=1", http.StatusMovedPermanently, "https://example.com:8443/a%2Fb?x=1"},
+		{"code and port", models.RedirectData{HTTPCode: 308, Port: "443"}, "http://example.com/a", http.StatusPermanentRedirect, "https://example.com/a"},
+		{"canonical host", models.RedirectData{Host: "example.com", Port: "443"}, "http://www.example.com/a", http.StatusMovedPermanently, "https://example.com/a"},
+		{"hsts friendly", models.RedirectData{Host: "example.com", Port: "443", HSTSFriendly: true}, "http://www.example.com/a", http.StatusMovedPermanently, "https://www.example.com/a"},
+		{"ipv6", models.RedirectData{Port: "443"}, "http://[::1]/a", http.StatusMovedPermanently, "https://[::1]/a"},
+	}
+
+	for _, test := range tests {
+		httpServer := newRedirectTestServer(&models.Config{
+			ListenAddresses: []models.ListenAddress{
+				{Address: ":80", Task: models.HTTPRedirectTask, TaskData: models.TaskData{Redirect: test.redirect}},
+				{Address: ":8443", SSL: true},
+			},
+		})
+
+		rec := httptest.NewRecorder()
+		httpServer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.target, nil))
+		if rec.Code != test.code || rec.Header().Get("Location") != test.location {
+			t.Errorf("%s: expected %d '%s', got %d '%s'", test.name, test.code, test.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	// HEAD requests don't get a body
+	httpServer := newRedirectTestServer(&models.Config{
+		ListenAddresses: []models.ListenAddress{{Address: ":80", Task: models.HTTPRedirectTask}},
+	})
+	rec := httptest.NewRecorder()
+	httpServer.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "http://example.com/", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Body.Len() > 0 {
+		t.Fatalf("unexpected HEAD response %d '%s'", rec.Code, rec.Body)
+	}
+}
+
+func TestRedirectTaskExceptPaths(t *testing.T) {
+	redirect := models.RedirectData{ExceptPaths: []string{"/.well-known/acme-challenge/"}}
+	if !redirect.IsException("/.well-known/acme-challenge/token") {
+		t.Fatal("expected ACME challenges to be excepted")
+	}
+	if redirect.IsException("/.well-known/other") || redirect.IsException("/") {
+		t.Fatal("unexpected exception")
+	}
+
+	if msg := (models.RedirectData{HTTPCode: 200}).Check(); len(msg) == 0 {
+		t.Fatal("expected invalid HTTPCode to be rejected")
+	}
+}
+
+func TestCanonicalHostRedirect(t *testing.T) {
+	config := &models.Config{
+		ListenAddresses: []models.ListenAddress{
+			{Address: ":80", Task: models.HTTPRedirectTask, TaskData: models.TaskData{
+				Redirect: models.RedirectData{Host: "example.com", HSTSFriendly: true, HTTPCode: 308},
+			}},
+		},
+	}
+	httpServer := &HTTPServer{
+		Config: config,
+		Routes: []*models.Route{
+			{ServerNames: []string{"example.com", "www.example.com"}},
+			{ServerNames: []string{"other.com"}},
+		},
+	}
+
+	tests := []struct {
+		target   string
+		location string
+	}{
+		{"https://www.example.com/a?x=1", "https://example.com/a?x=1"},
+		{"https://www.example.com:8443/a", "https://example.com:8443/a"},
+		{"https://example.com/a", ""},
+		{"https://other.com/a", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.target, nil)
+		req.TLS = &tls.ConnectionState{}
+		req.URL.Host = req.Host
+
+		rec := httptest.NewRecorder()
+		redirected := httpServer.canonicalHostRedirect(rec, req)
+		if redirected != (len(test.location) > 0) {
+			t.Errorf("%s: expected redirect %v, got %v", test.target, len(test.location) > 0, redirected)
+			continue
+		}
+		if redirected && (rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != test.location) {
+			t.Errorf("%s: expected 308 '%s', got %d '%s'", test.target, test.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Add the security headers of a policy to a response header. Headers set by the
+// upstream are kept unless the policy is forced. HSTS is only sent over TLS
+func applySecurityHeaders(header http.Header, policy *models.SecurityPolicy, ssl bool) {
+	if policy == nil {
+		return
+	}
+
+	setHeader := func(name, value string) {
+		if policy.Force || len(header.Values(name)) == 0 {
+			header.Set(name, value)
+		}
+	}
+
+	for name, value := range policy.Headers {
+		setHeader(name, value)
+	}
+
+	if ssl && len(policy.HSTS) > 0 {
+		setHeader("Strict-Transport-Security", policy.HSTS)
+	}
+}
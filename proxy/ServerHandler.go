@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,10 +17,17 @@ import (
 
 // ReverseProxyServer a reverseproxy server
 type ReverseProxyServer struct {
-	Config *models.Config
-	Routes []models.Route
-	Server []HTTPServer
-	Debug  bool
+	Config     *models.Config
+	Routes     []models.Route
+	Server     []HTTPServer
+	TCPServers []*TCPServer
+	UDPServers []*UDPServer
+	Caches     map[*models.RouteLocation]*ResponseCache
+	Auths      map[*models.RouteLocation]*Authenticator
+	OIDC       map[*models.OIDCConfig]*OIDCProvider
+	ClientCAs  map[*models.ClientCertConfig]*x509.CertPool
+	AccessLog  *AccessLog
+	Debug      bool
 }
 
 // NewReverseProxyServere create a new reverseproxy server
@@ -32,9 +40,67 @@ func NewReverseProxyServere(config *models.Config, routes []models.Route) *Rever
 
 // InitHTTPServers inits all http servers
 func (server *ReverseProxyServer) InitHTTPServers() {
-	var foundRoutes int
+	var foundRoutes, passthroughs int
+	server.initCaches()
+	server.initAuths()
+	server.initClientCAs()
+
+	// Open access log
+	if len(server.Config.Server.AccessLog) > 0 {
+		accessLog, err := NewAccessLog(server.Config.Server.AccessLog)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		server.AccessLog = accessLog
+	}
 
 	for i, listenAddress := range server.Config.ListenAddresses {
+		if listenAddress.IsUnix() {
+			if listenAddress.GetTask() == models.UDPTask {
+				log.Fatalf("udp addresses can't be unix sockets: '%s'", listenAddress.Address)
+			}
+			if listenAddress.HTTP3 {
+				log.Warnf("HTTP3 isn't supported by unix sockets. Ignoring it for address '%s'", listenAddress.Address)
+			}
+		}
+		if listenAddress.UnixSocket != nil {
+			if msg := listenAddress.UnixSocket.Check(); len(msg) > 0 {
+				log.Fatalf("%s for address '%s'", msg, listenAddress.Address)
+			}
+		}
+
+		if listenAddress.ProxyProtocol != nil {
+			if msg := listenAddress.ProxyProtocol.Check(); len(msg) > 0 {
+				log.Fatalf("%s for address '%s'", msg, listenAddress.Address)
+			}
+			if listenAddress.GetTask() == models.UDPTask {
+				log.Warnf("PROXY protocol isn't supported by udp addresses. Ignoring it for address '%s'", listenAddress.Address)
+			}
+		}
+
+		if listenAddress.GetTask() == models.HTTPRedirectTask {
+			if msg := listenAddress.TaskData.Redirect.Check(); len(msg) > 0 {
+				log.Fatalf("%s for address '%s'", msg, listenAddress.Address)
+			}
+		}
+
+		// Forward raw connections of tcp and udp addresses
+		if listenAddress.IsStreamTask() {
+			if listenAddress.TaskData.Stream == nil {
+				log.Fatalf("Missing Stream data for address '%s'", listenAddress.Address)
+			}
+			if msg := listenAddress.TaskData.Stream.Check(); len(msg) > 0 {
+				log.Fatalf("%s for address '%s'", msg, listenAddress.Address)
+			}
+
+			if listenAddress.GetTask() == models.UDPTask {
+				server.UDPServers = append(server.UDPServers, NewUDPServer(&server.Config.ListenAddresses[i]))
+			} else {
+				server.TCPServers = append(server.TCPServers, NewTCPServer(&server.Config.ListenAddresses[i]))
+			}
+			continue
+		}
+
 		serverConf := server.Config.Server
 
 		httpServer := http.Server{
@@ -42,17 +108,38 @@ func (server *ReverseProxyServer) InitHTTPServers() {
 			MaxHeaderBytes: int(serverConf.MaxHeaderSize.Bytes()),
 			ReadTimeout:    time.Duration(serverConf.ReadTimeout),
 			WriteTimeout:   time.Duration(serverConf.WriteTimeout),
+			IdleTimeout:    serverConf.GetIdleTimeout(),
+		}
+
+		if listenAddress.Passthrough != nil {
+			if !listenAddress.SSL {
+				log.Fatalf("Passthrough requires SSL for address '%s'", listenAddress.Address)
+			}
+			if msg := listenAddress.Passthrough.Check(); len(msg) > 0 {
+				log.Fatalf("%s for address '%s'", msg, listenAddress.Address)
+			}
+			passthroughs++
+		}
+
+		if listenAddress.HTTP3 && !listenAddress.SSL {
+			log.Warnf("HTTP3 requires SSL. Ignoring it for address '%s'", listenAddress.Address)
+		}
+
+		if listenAddress.H2C && listenAddress.SSL {
+			log.Warnf("H2C can't be used with SSL. Ignoring it for address '%s'", listenAddress.Address)
 		}
 
 		// If address is ssl address, add tls config
 		if listenAddress.SSL {
 			certKeyPairs := models.GetTLSCerts(server.Routes, &server.Config.ListenAddresses[i])
-			if len(certKeyPairs) == 0 {
+			if len(certKeyPairs) == 0 && listenAddress.Passthrough == nil {
 				logrus.Warnf("Couldn't find any certificate pairs for Address '%s'. This Route/Server might be unavailable", listenAddress.Address)
 				continue
 			}
 
-			tlsConfig := &tls.Config{}
+			tlsConfig := &tls.Config{
+				NextProtos: []string{"h2", "http/1.1"},
+			}
 			for _, pair := range certKeyPairs {
 				log.Debug("Found cert: ", pair.Cert, " Key: ", pair.Key)
 
@@ -68,6 +155,9 @@ func (server *ReverseProxyServer) InitHTTPServers() {
 
 			tlsConfig.BuildNameToCertificate()
 
+			// Request client certificates for routes which need them
+			server.clientCertTLSConfigs(tlsConfig, models.GetRoutesFromAddress(server.Routes, server.Config.ListenAddresses[i]))
+
 			// Set tls config
 			httpServer.TLSConfig = tlsConfig
 		}
@@ -80,6 +170,11 @@ func (server *ReverseProxyServer) InitHTTPServers() {
 			Routes:        routes,
 			Debug:         server.Debug,
 			Config:        server.Config,
+			Caches:        server.Caches,
+			Auths:         server.Auths,
+			OIDC:          server.OIDC,
+			ClientCAs:     server.ClientCAs,
+			AccessLog:     server.AccessLog,
 			ListenAddress: &server.Config.ListenAddresses[i],
 		})
 
@@ -87,17 +182,83 @@ func (server *ReverseProxyServer) InitHTTPServers() {
 	}
 
 	// Exit if no route was found
-	if foundRoutes == 0 {
+	if foundRoutes == 0 && passthroughs == 0 && len(server.TCPServers) == 0 && len(server.UDPServers) == 0 {
 		log.Fatal("No route found")
 	}
 }
 
+// Create a response cache for each location which has one configured
+func (server *ReverseProxyServer) initCaches() {
+	server.Caches = make(map[*models.RouteLocation]*ResponseCache)
+
+	for i := range server.Routes {
+		for j := range server.Routes[i].Locations {
+			location := &server.Routes[i].Locations[j]
+			if location.Cache == nil {
+				continue
+			}
+
+			log.Debugf("Using cache for location '%s' in %s", location.Location, server.Routes[i].FileName)
+			server.Caches[location] = NewResponseCache(location.Cache)
+		}
+	}
+}
+
+// Create an authenticator for each location which requires authentication
+func (server *ReverseProxyServer) initAuths() {
+	server.Auths = make(map[*models.RouteLocation]*Authenticator)
+	server.OIDC = make(map[*models.OIDCConfig]*OIDCProvider)
+
+	for i := range server.Routes {
+		route := &server.Routes[i]
+
+		// All locations of a route with OIDC require a login
+		var provider *OIDCProvider
+		if route.OIDC != nil {
+			var err error
+			if provider, err = NewOIDCProvider(route.OIDC); err != nil {
+				log.Fatalln(err)
+			}
+			server.OIDC[route.OIDC] = provider
+		}
+
+		for j := range route.Locations {
+			location := &route.Locations[j]
+			if location.Auth == nil && provider == nil {
+				continue
+			}
+
+			config := location.Auth
+			if config == nil {
+				config = &models.LocationAuth{}
+			}
+
+			auth := NewAuthenticator(config)
+			auth.oidc = provider
+			server.Auths[location] = auth
+		}
+	}
+}
+
 // Start starts the server
 func (server *ReverseProxyServer) Start() {
 	for i := range server.Server {
 		server.Server[i].Start()
 	}
 
+	for i := range server.TCPServers {
+		server.TCPServers[i].Start()
+	}
+
+	for i := range server.UDPServers {
+		server.UDPServers[i].Start()
+	}
+
+	// Start admin interface
+	if server.Config.Admin != nil && len(server.Config.Admin.Address) > 0 {
+		go server.runAdmin()
+	}
+
 	// Wait for shutting down
 	server.WaitForShutdown()
 }
@@ -115,11 +276,33 @@ func (server *ReverseProxyServer) WaitForShutdown() {
 	defer cancel()
 
 	log.Info("Shutting down server")
+	server.Shutdown(ctx)
+	log.Info("Shutting down complete")
+	os.Exit(0)
+}
 
+// Shutdown stops all servers and waits for active connections until ctx is done
+func (server *ReverseProxyServer) Shutdown(ctx context.Context) {
 	for i := range server.Server {
 		server.Server[i].Server.Shutdown(ctx)
+		if server.Server[i].HTTP3 != nil {
+			server.Server[i].HTTP3.Shutdown(ctx)
+		}
+		if server.Server[i].passthrough != nil {
+			server.Server[i].passthrough.Shutdown(ctx)
+		}
 	}
 
-	log.Info("Shutting down complete")
-	os.Exit(0)
+	for i := range server.TCPServers {
+		server.TCPServers[i].Shutdown(ctx)
+	}
+
+	for i := range server.UDPServers {
+		server.UDPServers[i].Shutdown(ctx)
+	}
+
+	// Hijacked connections aren't closed by Shutdown
+	for i := range server.Server {
+		server.Server[i].webSockets.closeAll(ctx)
+	}
 }
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Max size of a single cookie value. Larger values are split into multiple cookies
+const maxCookieSize = 3800
+
+// Max count of cookies a value gets split into
+const maxCookieChunks = 5
+
+// cookieCodec encrypts values stored in cookies using AES-GCM
+type cookieCodec struct {
+	aead cipher.AEAD
+}
+
+func newCookieCodec(secret string) (*cookieCodec, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cookieCodec{aead: aead}, nil
+}
+
+// Encrypt a value. The name of the cookie is authenticated as well
+func (codec *cookieCodec) encode(name string, value interface{}) (string, error) {
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, codec.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := codec.aead.Seal(nonce, nonce, plain, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt a value created by encode
+func (codec *cookieCodec) decode(name, encoded string, value interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+
+	nonceSize := codec.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return errors.New("cookie too short")
+	}
+
+	plain, err := codec.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(plain, value)
+}
+
+// Write an encrypted cookie. Values too big for a single cookie are split
+func (codec *cookieCodec) setCookie(w http.ResponseWriter, req *http.Request, template http.Cookie, value interface{}) error {
+	encoded, err := codec.encode(template.Name, value)
+	if err != nil {
+		return err
+	}
+
+	var chunks []string
+	for len(encoded) > maxCookieSize {
+		chunks = append(chunks, encoded[:maxCookieSize])
+		encoded = encoded[maxCookieSize:]
+	}
+	chunks = append(chunks, encoded)
+
+	if len(chunks) > maxCookieChunks {
+		return errors.New("cookie value too big")
+	}
+
+	for i := 0; i < maxCookieChunks; i++ {
+		cookie := template
+		cookie.Name = chunkName(template.Name, i)
+		if i < len(chunks) {
+			cookie.Value = chunks[i]
+		} else if _, err := req.Cookie(cookie.Name); err == nil {
+			// Remove chunks of older values
+			cookie.MaxAge = -1
+		} else {
+			continue
+		}
+
+		http.SetCookie(w, &cookie)
+	}
+
+	return nil
+}
+
+// Read an encrypted cookie written by setCookie
+func (codec *cookieCodec) readCookie(req *http.Request, name string, value interface{}) error {
+	var sb strings.Builder
+	for i := 0; i < maxCookieChunks; i++ {
+		cookie, err := req.Cookie(chunkName(name, i))
+		if err != nil {
+			break
+		}
+		sb.WriteString(cookie.Value)
+	}
+
+	if sb.Len() == 0 {
+		return http.ErrNoCookie
+	}
+
+	return codec.decode(name, sb.String(), value)
+}
+
+// Remove all chunks of a cookie
+func clearCookie(w http.ResponseWriter, req *http.Request, template http.Cookie) {
+	for i := 0; i < maxCookieChunks; i++ {
+		cookie := template
+		cookie.Name = chunkName(template.Name, i)
+		if _, err := req.Cookie(cookie.Name); err != nil && i > 0 {
+			continue
+		}
+
+		cookie.Value = ""
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+		http.SetCookie(w, &cookie)
+	}
+}
+
+func chunkName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return name + "_" + strconv.Itoa(i)
+}
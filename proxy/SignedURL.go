@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Verify the signature of a request and remove the signature parameters
+// before it gets proxied. Returns false if the request was denied
+func checkSignedURL(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) bool {
+	config := location.SignedURL
+
+	err := config.Verify(req.URL.Path, req.URL.Query(), clientIP(req, location), time.Now())
+	if err != nil {
+		log.Debugf("Signed URL from %s rejected: %s", req.RemoteAddr, err)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	req.URL.RawQuery = removeQueryParams(req.URL.RawQuery, config.GetExpiresParam(), config.GetSignatureParam())
+	return true
+}
+
+// Remove parameters from a raw query while keeping the order and encoding
+// of the other ones
+func removeQueryParams(rawQuery string, names ...string) string {
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+
+	for _, part := range parts {
+		key := part
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			key = part[:i]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+
+		remove := false
+		for _, name := range names {
+			if key == name {
+				remove = true
+				break
+			}
+		}
+
+		if !remove && len(part) > 0 {
+			kept = append(kept, part)
+		}
+	}
+
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+const testSignedURLSecret = "0123456789abcdef0123"
+
+// Return a location requiring URLs signed by config
+func newSignedURLLocation(config *models.SignedURLConfig) *models.RouteLocation {
+	route := &models.Route{ServerNames: []string{"x"}}
+	route.Locations = []models.RouteLocation{{Location: "/files/", Destination: "http://127.0.0.1:8080/", SignedURL: config}}
+	route.Locations[0].Init(route)
+	return &route.Locations[0]
+}
+
+// Sign target like the sign-url subcommand does
+func signTestURL(t *testing.T, config *models.SignedURLConfig, target string, expires time.Time, ip string) string {
+	t.Helper()
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Sign(u, expires, ip)
+	return u.String()
+}
+
+func TestCheckSignedURL(t *testing.T) {
+	config := &models.SignedURLConfig{Secret: testSignedURLSecret}
+	location := newSignedURLLocation(config)
+	valid := signTestURL(t, config, "http://x/files/a.txt?b=2&a=1", time.Now().Add(time.Minute), "")
+
+	tests := []struct {
+		name    string
+		target  string
+		allowed bool
+	}{
+		{"valid", valid, true},
+		{"missing", "http://x/files/a.txt?b=2&a=1", false},
+		{"expired", signTestURL(t, config, "http://x/files/a.txt", time.Now().Add(-time.Minute), ""), false},
+		{"other path", strings.Replace(valid, "/files/a.txt", "/files/b.txt", 1), false},
+		{"extended expiry", strings.Replace(valid, "expires=", "expires=9", 1), false},
+		{"other secret", signTestURL(t, &models.SignedURLConfig{Secret: "another secret of 16+"}, "http://x/files/a.txt", time.Now().Add(time.Minute), ""), false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.target, nil)
+		rec := httptest.NewRecorder()
+		if allowed := checkSignedURL(rec, req, location); allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", test.name, test.allowed, allowed)
+			continue
+		}
+
+		if !test.allowed && rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", test.name, rec.Code)
+		}
+
+		// The signature parameters don't reach the upstream
+		if test.allowed && req.URL.RawQuery != "a=1&b=2" {
+			t.Errorf("%s: expected the signature parameters to be removed, got '%s'", test.name, req.URL.RawQuery)
+		}
+	}
+}
+
+func TestCheckSignedURLBindIP(t *testing.T) {
+	config := &models.SignedURLConfig{Secret: testSignedURLSecret, BindIP: true, ExpiresParam: "e", SignatureParam: "s"}
+	location := newSignedURLLocation(config)
+	target := signTestURL(t, config, "http://x/files/a.txt", time.Now().Add(time.Minute), "203.0.113.7")
+
+	for remoteAddr, allowed := range map[string]bool{"203.0.113.7:1234": true, "192.0.2.1:1234": false} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = remoteAddr
+		if checkSignedURL(httptest.NewRecorder(), req, location) != allowed {
+			t.Errorf("%s: expected allowed=%v", remoteAddr, allowed)
+		}
+		if allowed && len(req.URL.RawQuery) > 0 {
+			t.Errorf("expected the custom signature parameters to be removed, got '%s'", req.URL.RawQuery)
+		}
+	}
+}
+
+func TestRemoveQueryParams(t *testing.T) {
+	tests := map[string]string{
+		"":                              "",
+		"expires=1&signature=x":         "",
+		"b=%2F&expires=1&a&signature=x": "b=%2F&a",
+		"sig%6Eature=x&z=1":             "z=1",
+		"signatures=x&expires_at=1&c=3": "signatures=x&expires_at=1&c=3",
+	}
+
+	for rawQuery, expected := range tests {
+		if query := removeQueryParams(rawQuery, "expires", "signature"); query != expected {
+			t.Errorf("%q: expected %q, got %q", rawQuery, expected, query)
+		}
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.RawQuery)
+	}))
+	defer upstream.Close()
+
+	config := &models.SignedURLConfig{Secret: testSignedURLSecret}
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations:   []models.RouteLocation{{Location: "/files/", Destination: upstream.URL + "/", SignedURL: config}},
+	})
+	address := "http://" + server.Server[0].ListenAddress.Address
+
+	resp, err := http.Get(signTestURL(t, config, address+"/files/a.txt?x=1", time.Now().Add(time.Minute), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "x=1" {
+		t.Fatalf("expected the upstream to get the query without signature, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(address + "/files/a.txt?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected unsigned requests to be denied, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// File extensions of precompressed files
+var precompressedEncodings = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+var errStaticNotFound = errors.New("File not found")
+
+// Serve a file of a static location
+func (httpServer *HTTPServer) staticTask(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	static := location.Static
+	rel := location.RelativePath(req.URL.Path)
+	isDirPath := strings.HasSuffix(req.URL.Path, "/")
+
+	file, err := resolveStaticFile(static, rel, isDirPath)
+	if err == errStaticNotFound && static.SPA {
+		file, err = resolveStaticFile(static, "/"+static.GetIndex()[0], false)
+	}
+
+	if err != nil {
+		if err != errStaticNotFound {
+			log.Error(err)
+		}
+		http.Error(w, "404 Not Found", http.StatusNotFound)
+		return
+	}
+
+	// Redirect directories to their path with a trailing slash
+	if file.redirect {
+		target := req.URL.Path + "/"
+		if len(req.URL.RawQuery) > 0 {
+			target += "?" + req.URL.RawQuery
+		}
+		http.Redirect(w, req, target, http.StatusMovedPermanently)
+		return
+	}
+
+	serveStaticFile(w, req, static, file.name)
+}
+
+// staticFile a resolved file of a static location
+type staticFile struct {
+	name     string
+	redirect bool
+}
+
+// Map a request path to a file in the root directory. isDirPath indicates
+// whether the requested path ends with a slash
+func resolveStaticFile(static *models.StaticConfig, rel string, isDirPath bool) (*staticFile, error) {
+	if strings.ContainsAny(rel, "\x00\\") {
+		return nil, errStaticNotFound
+	}
+
+	cleaned := path.Clean("/" + rel)
+
+	// Don't serve hidden files
+	if !static.AllowHidden {
+		for _, item := range strings.Split(cleaned, "/") {
+			if strings.HasPrefix(item, ".") {
+				return nil, errStaticNotFound
+			}
+		}
+	}
+
+	name := filepath.Join(static.Root, filepath.FromSlash(cleaned))
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, errStaticNotFound
+	}
+
+	if info.IsDir() {
+		if !isDirPath {
+			return &staticFile{redirect: true}, nil
+		}
+
+		// Find index file
+		found := false
+		for _, index := range static.GetIndex() {
+			indexName := filepath.Join(name, index)
+			if info, err := os.Stat(indexName); err == nil && info.Mode().IsRegular() {
+				name, found = indexName, true
+				break
+			}
+		}
+
+		if !found {
+			return nil, errStaticNotFound
+		}
+	} else if !info.Mode().IsRegular() {
+		return nil, errStaticNotFound
+	}
+
+	if !static.FollowSymlinks && !isInRoot(static.Root, name) {
+		return nil, errStaticNotFound
+	}
+
+	return &staticFile{name: name}, nil
+}
+
+// Return true if the real path of name is inside of root
+func isInRoot(root, name string) bool {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+
+	realName, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(realRoot, realName)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Serve a file. Takes care of precompressed files, caching headers and range requests
+func serveStaticFile(w http.ResponseWriter, req *http.Request, static *models.StaticConfig, name string) {
+	header := w.Header()
+	servedName := name
+
+	// Use precompressed file if possible
+	if static.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"), []string{"br", "gzip"})
+		if len(encoding) > 0 {
+			compressedName := name + precompressedEncodings[encoding]
+			if info, err := os.Stat(compressedName); err == nil && info.Mode().IsRegular() &&
+				(static.FollowSymlinks || isInRoot(static.Root, compressedName)) {
+				servedName = compressedName
+				header.Set("Content-Encoding", encoding)
+
+				contentType := mime.TypeByExtension(filepath.Ext(name))
+				if len(contentType) == 0 {
+					contentType = "application/octet-stream"
+				}
+				header.Set("Content-Type", contentType)
+			}
+		}
+	}
+
+	f, err := os.Open(servedName)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "404 Not Found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	header.Set("ETag", fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size()))
+	if len(static.CacheControl) > 0 {
+		header.Set("Cache-Control", static.CacheControl)
+	}
+
+	// Handles conditional and range requests
+	http.ServeContent(w, req, filepath.Base(name), info.ModTime(), f)
+}
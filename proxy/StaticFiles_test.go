@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Create a static root next to a secret file. The root contains a symlink to
+// the secret and one to a file inside of it. Returns the root
+func newStaticRoot(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	files := map[string]string{
+		filepath.Join(dir, "secret.txt"):  "secret",
+		filepath.Join(root, "index.html"): "index",
+		filepath.Join(root, "a.txt"):      "a",
+		filepath.Join(root, ".env"):       "hidden",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "out.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "outdir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(root, "in.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+// Return a static location serving root at /static/
+func newStaticLocation(static *models.StaticConfig) *models.RouteLocation {
+	route := &models.Route{ServerNames: []string{"x"}}
+	route.Locations = []models.RouteLocation{{Location: "/static/", Static: static}}
+	route.Locations[0].Init(route)
+	return &route.Locations[0]
+}
+
+func TestStaticTraversal(t *testing.T) {
+	root := newStaticRoot(t)
+	location := newStaticLocation(&models.StaticConfig{Root: root})
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/static/a.txt", http.StatusOK, "a"},
+		{"/static/", http.StatusOK, "index"},
+		{"/static/../secret.txt", http.StatusNotFound, ""},
+		{"/static/../../secret.txt", http.StatusNotFound, ""},
+		{"/static/x/../../secret.txt", http.StatusNotFound, ""},
+		{"/static/%2e%2e/secret.txt", http.StatusNotFound, ""},
+		{"/static/%2E%2E%2Fsecret.txt", http.StatusNotFound, ""},
+		{"/static/..%5Csecret.txt", http.StatusNotFound, ""},
+		{"/static/a.txt%00.html", http.StatusNotFound, ""},
+		{"/static/.env", http.StatusNotFound, ""},
+		{"/static/in.txt", http.StatusOK, "a"},
+		{"/static/out.txt", http.StatusNotFound, ""},
+		{"/static/outdir/secret.txt", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		(&HTTPServer{}).staticTask(rec, httptest.NewRequest(http.MethodGet, "http://x"+test.target, nil), location)
+
+		if rec.Code != test.code || (test.code == http.StatusOK && rec.Body.String() != test.body) {
+			t.Errorf("%s: expected %d '%s', got %d '%s'", test.target, test.code, test.body, rec.Code, rec.Body)
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("%s: secret file was served", test.target)
+		}
+	}
+
+	// Symlinks out of the root can be allowed, the path still can't leave it
+	location = newStaticLocation(&models.StaticConfig{Root: root, FollowSymlinks: true})
+	rec := httptest.NewRecorder()
+	(&HTTPServer{}).staticTask(rec, httptest.NewRequest(http.MethodGet, "http://x/static/out.txt", nil), location)
+	if rec.Code != http.StatusOK || rec.Body.String() != "secret" {
+		t.Fatalf("expected the symlink to be followed, got %d '%s'", rec.Code, rec.Body)
+	}
+
+	for _, target := range []string{"/static/../secret.txt", "/static/x/../../secret.txt", "/static/%2e%2e/secret.txt"} {
+		rec := httptest.NewRecorder()
+		(&HTTPServer{}).staticTask(rec, httptest.NewRequest(http.MethodGet, "http://x"+target, nil), location)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 following symlinks, got %d '%s'", target, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestStaticTraversalRequest(t *testing.T) {
+	root := newStaticRoot(t)
+	server := startTestServer(t, models.ListenAddress{}, &models.Route{
+		ServerNames: []string{"127.0.0.1"},
+		Locations:   []models.RouteLocation{{Location: "/static/", Static: &models.StaticConfig{Root: root}}},
+	})
+
+	// Send the paths unmodified, HTTP clients would clean them
+	for _, target := range []string{"/static/../secret.txt", "/static/%2e%2e/secret.txt", "/static/..%2fsecret.txt"} {
+		conn, err := net.Dial("tcp", server.Server[0].ListenAddress.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: 127.0.0.1\r\nConnection: close\r\n\r\n")
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		conn.Close()
+
+		if resp.StatusCode == http.StatusOK || strings.Contains(string(body), "secret") {
+			t.Errorf("%s: expected the secret to be hidden, got %d '%s'", target, resp.StatusCode, body)
+		}
+	}
+}
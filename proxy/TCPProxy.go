@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	"github.com/pires/go-proxyproto"
+	log "github.com/sirupsen/logrus"
+)
+
+// TCPServer forwards raw TCP connections of an address to upstreams
+type TCPServer struct {
+	ListenAddress *models.ListenAddress
+	Data          *models.StreamData
+
+	listener net.Listener
+	balancer *balancer
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewTCPServer creates a server for an address using the tcp task
+func NewTCPServer(address *models.ListenAddress) *TCPServer {
+	return newStreamForwarder(address, address.TaskData.Stream)
+}
+
+// Create a server forwarding connections accepted by address to the upstreams
+// of data. Connections are passed to forward if it doesn't listen itself
+func newStreamForwarder(address *models.ListenAddress, data *models.StreamData) *TCPServer {
+	return &TCPServer{
+		ListenAddress: address,
+		Data:          data,
+		balancer:      newBalancer(data.GetBalance(), data.Upstreams),
+		conns:         make(map[net.Conn]struct{}),
+	}
+}
+
+// Forward a connection accepted by another listener
+func (server *TCPServer) forward(conn net.Conn) {
+	server.wg.Add(1)
+	go server.handle(conn)
+}
+
+// Start listens on the address and forwards all connections
+func (server *TCPServer) Start() {
+	listener, err := listen(server.ListenAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.listener = listener
+
+	log.Debugf("Starting TCP proxy on '%s' with %d upstreams", server.ListenAddress.GetAddress(), len(server.Data.Upstreams))
+	go server.serve()
+}
+
+// Accept connections until the listener gets closed
+func (server *TCPServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			log.Error("TCP accept: ", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		server.forward(conn)
+	}
+}
+
+// Shutdown stops accepting connections and waits for the active ones until
+// ctx is done
+func (server *TCPServer) Shutdown(ctx context.Context) {
+	if server.listener != nil {
+		server.listener.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		server.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		server.mutex.Lock()
+		for conn := range server.conns {
+			conn.Close()
+		}
+		server.mutex.Unlock()
+	}
+}
+
+func (server *TCPServer) track(conn net.Conn, add bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if add {
+		server.conns[conn] = struct{}{}
+	} else {
+		delete(server.conns, conn)
+	}
+}
+
+// Forward a client connection to an upstream
+func (server *TCPServer) handle(conn net.Conn) {
+	defer server.wg.Done()
+	defer conn.Close()
+
+	server.track(conn, true)
+	defer server.track(conn, false)
+
+	listener := server.ListenAddress.GetAddress()
+	clientIP := stripPort(conn.RemoteAddr().String())
+	if !server.Data.IsAllowed(net.ParseIP(clientIP)) {
+		log.Debugf("IP %s is not allowed", clientIP)
+		metrics.get(counterMetric, "reverseproxy_tcp_denied_connections_total", "TCP connections denied by the allow list", "listener", listener).add(1)
+		return
+	}
+
+	upstreamConn, upstream := server.dial(clientIP)
+	if upstreamConn == nil {
+		return
+	}
+	defer upstreamConn.Close()
+
+	// Send the client address to the upstream
+	if server.Data.SendProxyProtocol > 0 {
+		if err := writeProxyHeader(upstreamConn, server.Data.SendProxyProtocol, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			log.Warnf("Can't send PROXY protocol header to '%s': %s", upstream.address, err)
+			return
+		}
+	}
+
+	atomic.AddInt64(&upstream.active, 1)
+	defer atomic.AddInt64(&upstream.active, -1)
+
+	labels := []string{"listener", listener, "upstream", upstream.address}
+	metrics.get(counterMetric, "reverseproxy_tcp_connections_total", "Forwarded TCP connections", labels...).add(1)
+	connections := metrics.get(gaugeMetric, "reverseproxy_tcp_connections", "Active TCP connections", labels...)
+	connections.add(1)
+	defer connections.add(-1)
+
+	received := metrics.get(counterMetric, "reverseproxy_tcp_received_bytes_total", "Bytes received from TCP clients", labels...)
+	sent := metrics.get(counterMetric, "reverseproxy_tcp_sent_bytes_total", "Bytes sent to TCP clients", labels...)
+	pipeConns(conn, upstreamConn, server.Data.GetIdleTimeout(), received, sent)
+}
+
+// Connect to the upstream selected by the balancer. Tries the other upstreams
+// if it's unreachable
+func (server *TCPServer) dial(clientIP string) (net.Conn, *upstream) {
+	for _, upstream := range server.balancer.candidates(clientIP) {
+		conn, err := net.DialTimeout("tcp", upstream.address, server.Data.GetConnectTimeout())
+		if err == nil {
+			return conn, upstream
+		}
+		log.Warnf("Can't connect to upstream '%s': %s", upstream.address, err)
+	}
+
+	log.Errorf("No upstream of '%s' is reachable", server.ListenAddress.GetAddress())
+	return nil, nil
+}
+
+// Copy data in both directions until both sides are done or the connection
+// was idle for idleTimeout
+func pipeConns(client, upstream net.Conn, idleTimeout time.Duration, received, sent *metric) {
+	lastActivity := time.Now().UnixNano()
+
+	errc := make(chan error, 2)
+	go func() {
+		errc <- copyStream(upstream, client, idleTimeout, &lastActivity, received)
+	}()
+	go func() {
+		errc <- copyStream(client, upstream, idleTimeout, &lastActivity, sent)
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			// Unblock the other direction
+			client.Close()
+			upstream.Close()
+		}
+	}
+}
+
+// Copy src to dst. Closes the write side of dst once src is done, so the
+// other direction can finish
+func copyStream(dst, src net.Conn, idleTimeout time.Duration, lastActivity *int64, counter *metric) error {
+	buf := make([]byte, 32*1024)
+	for {
+		src.SetReadDeadline(time.Unix(0, atomic.LoadInt64(lastActivity)).Add(idleTimeout))
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			atomic.StoreInt64(lastActivity, time.Now().UnixNano())
+			counter.add(int64(n))
+
+			dst.SetWriteDeadline(time.Now().Add(idleTimeout))
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			// Continue as long as the other direction is active
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && time.Since(time.Unix(0, atomic.LoadInt64(lastActivity))) < idleTimeout {
+				continue
+			}
+
+			if err == io.EOF && closeWrite(dst) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Close the write side of conn. Returns false if it's not supported
+func closeWrite(conn net.Conn) bool {
+	switch conn := conn.(type) {
+	case interface{ CloseWrite() error }:
+		return conn.CloseWrite() == nil
+	case *proxyproto.Conn:
+		return closeWrite(conn.Raw())
+	}
+
+	return false
+}
@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Read everything until the client closes its write side, then answer with
+// "got " and the data. Returns the address and a counter of connections
+func newHalfCloseUpstream(t *testing.T) (string, *int64) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	var conns int64
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&conns, 1)
+
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				io.WriteString(conn, "got "+string(data))
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), &conns
+}
+
+// Send a greeting and close the write side, then read everything the client
+// sends. Returns the address and the data received by each connection
+func newGreetingUpstream(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	received := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				io.WriteString(conn, "hi")
+				conn.(*net.TCPConn).CloseWrite()
+				data, _ := io.ReadAll(conn)
+				received <- string(data)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), received
+}
+
+// Start a tcp task forwarding to the upstreams of data. Returns its address
+func startTCPProxy(t *testing.T, data models.StreamData, proxyProtocol *models.ProxyProtocolConfig) string {
+	t.Helper()
+
+	address := &models.ListenAddress{
+		Address:       "127.0.0.1:" + freePort(t),
+		Task:          models.TCPTask,
+		TaskData:      models.TaskData{Stream: &data},
+		ProxyProtocol: proxyProtocol,
+	}
+	server := NewTCPServer(address)
+	server.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+
+	return address.Address
+}
+
+// Send data, close the write side and return the complete answer
+func halfCloseRequest(t *testing.T, address string, header func(net.Conn), data string) string {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if header != nil {
+		header(conn)
+	}
+	io.WriteString(conn, data)
+	conn.(*net.TCPConn).CloseWrite()
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(reply)
+}
+
+func TestTCPProxyHalfClose(t *testing.T) {
+	trusted := &models.ProxyProtocolConfig{TrustedIPs: []string{"127.0.0.1"}}
+	header := func(conn net.Conn) {
+		writeProxyHeader(conn, 2, &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242}, conn.RemoteAddr())
+	}
+
+	// The client finishes first
+	upstream, _ := newHalfCloseUpstream(t)
+	address := startTCPProxy(t, models.StreamData{Upstreams: []string{upstream}}, nil)
+	if reply := halfCloseRequest(t, address, nil, "hello"); reply != "got hello" {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+
+	address = startTCPProxy(t, models.StreamData{Upstreams: []string{upstream}}, trusted)
+	if reply := halfCloseRequest(t, address, header, "hello"); reply != "got hello" {
+		t.Fatalf("unexpected reply through PROXY protocol %q", reply)
+	}
+
+	// The upstream finishes first, the client can still send data. Clients
+	// read using PROXY protocol are half-closed too
+	greeter, received := newGreetingUpstream(t)
+	for _, proxyProtocol := range []*models.ProxyProtocolConfig{nil, trusted} {
+		address := startTCPProxy(t, models.StreamData{Upstreams: []string{greeter}}, proxyProtocol)
+
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if proxyProtocol != nil {
+			header(conn)
+		}
+		if greeting, err := io.ReadAll(conn); err != nil || string(greeting) != "hi" {
+			t.Fatalf("unexpected greeting %q %v", greeting, err)
+		}
+		io.WriteString(conn, "bye")
+		conn.(*net.TCPConn).CloseWrite()
+
+		if data := <-received; data != "bye" {
+			t.Fatalf("proxy protocol %v: expected the upstream to receive data after its half-close, got %q", proxyProtocol != nil, data)
+		}
+	}
+}
+
+func TestTCPProxyIdleTimeout(t *testing.T) {
+	upstream, _ := newHalfCloseUpstream(t)
+	address := startTCPProxy(t, models.StreamData{
+		Upstreams:   []string{upstream},
+		IdleTimeout: models.ConfigDuration(300 * time.Millisecond),
+	}, nil)
+
+	// Traffic in one direction keeps the connection open, although the
+	// upstream doesn't send anything
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for i := 0; i < 6; i++ {
+		io.WriteString(conn, "x")
+		time.Sleep(100 * time.Millisecond)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+	if reply, _ := io.ReadAll(conn); string(reply) != "got xxxxxx" {
+		t.Fatalf("connection was closed while active, got %q", reply)
+	}
+
+	// Idle connections get closed
+	conn, err = net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("idle connection wasn't closed: %s", err)
+	}
+}
+
+func TestTCPProxyAllow(t *testing.T) {
+	upstream, conns := newHalfCloseUpstream(t)
+	address := startTCPProxy(t, models.StreamData{Upstreams: []string{upstream}, Allow: []string{"10.0.0.0/8"}}, nil)
+
+	if reply := halfCloseRequest(t, address, nil, "hello"); len(reply) > 0 {
+		t.Fatalf("denied client got a reply %q", reply)
+	}
+	if n := atomic.LoadInt64(conns); n != 0 {
+		t.Fatalf("denied client was forwarded %d times", n)
+	}
+}
+
+func TestTCPProxyFallback(t *testing.T) {
+	upstream, conns := newHalfCloseUpstream(t)
+	unreachable := "127.0.0.1:" + freePort(t)
+
+	address := startTCPProxy(t, models.StreamData{Upstreams: []string{unreachable, upstream}}, nil)
+	for i := 0; i < 4; i++ {
+		if reply := halfCloseRequest(t, address, nil, "hello"); reply != "got hello" {
+			t.Fatalf("unexpected reply %q", reply)
+		}
+	}
+	if n := atomic.LoadInt64(conns); n != 4 {
+		t.Fatalf("expected 4 connections to the reachable upstream, got %d", n)
+	}
+}
+
+func TestBalancerCandidates(t *testing.T) {
+	addresses := []string{"a:1", "b:1", "c:1"}
+	first := func(b *balancer, clientIP string) string {
+		candidates := b.candidates(clientIP)
+		if len(candidates) != len(addresses) {
+			t.Fatalf("expected all upstreams as candidates, got %d", len(candidates))
+		}
+		return candidates[0].address
+	}
+
+	roundRobin := newBalancer(models.BalanceRoundRobin, addresses)
+	for i := 0; i < 6; i++ {
+		if address := first(roundRobin, "10.0.0.1"); address != addresses[i%3] {
+			t.Fatalf("round robin: expected %s, got %s", addresses[i%3], address)
+		}
+	}
+
+	// The order of the others is kept for fallbacks
+	if candidates := roundRobin.candidates(""); candidates[1].address != "b:1" || candidates[2].address != "c:1" {
+		t.Fatal("unexpected order of fallback upstreams")
+	}
+
+	ipHash := newBalancer(models.BalanceIPHash, addresses)
+	selected := first(ipHash, "10.0.0.1")
+	for i := 0; i < 5; i++ {
+		if address := first(ipHash, "10.0.0.1"); address != selected {
+			t.Fatalf("ip hash: expected %s, got %s", selected, address)
+		}
+	}
+
+	leastConn := newBalancer(models.BalanceLeastConn, addresses)
+	leastConn.upstreams[0].active = 2
+	leastConn.upstreams[1].active = 1
+	leastConn.upstreams[2].active = 3
+	if address := first(leastConn, ""); address != "b:1" {
+		t.Fatalf("least conn: expected b:1, got %s", address)
+	}
+
+	if candidates := newBalancer(models.BalanceRandom, nil).candidates(""); candidates != nil {
+		t.Fatal("expected no candidates without upstreams")
+	}
+}
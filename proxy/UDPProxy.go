@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Max size of a UDP datagram
+const maxDatagramSize = 64 * 1024
+
+// UDPServer forwards UDP datagrams of an address to upstreams. Replies are
+// sent back to the client using a session per client address
+type UDPServer struct {
+	ListenAddress *models.ListenAddress
+	Data          *models.StreamData
+
+	conn     *net.UDPConn
+	balancer *balancer
+	// Resolved addresses of the upstreams
+	addrs map[*upstream]*net.UDPAddr
+
+	mutex    sync.Mutex
+	sessions map[string]*udpSession
+	wg       sync.WaitGroup
+}
+
+// udpSession a client and the connection to its upstream
+type udpSession struct {
+	client       *net.UDPAddr
+	upstream     *upstream
+	conn         *net.UDPConn
+	lastActivity int64
+}
+
+// NewUDPServer creates a server for an address using the udp task
+func NewUDPServer(address *models.ListenAddress) *UDPServer {
+	return &UDPServer{
+		ListenAddress: address,
+		Data:          address.TaskData.Stream,
+		balancer:      newBalancer(address.TaskData.Stream.GetBalance(), address.TaskData.Stream.Upstreams),
+		addrs:         make(map[*upstream]*net.UDPAddr),
+		sessions:      make(map[string]*udpSession),
+	}
+}
+
+// Start listens on the address and forwards all datagrams
+func (server *UDPServer) Start() {
+	addr, err := net.ResolveUDPAddr("udp", server.ListenAddress.GetAddress())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Resolve the upstreams once instead of for each new client
+	for _, upstream := range server.balancer.upstreams {
+		upstreamAddr, err := net.ResolveUDPAddr("udp", upstream.address)
+		if err != nil {
+			log.Fatalf("Can't resolve upstream '%s': %s", upstream.address, err)
+		}
+		server.addrs[upstream] = upstreamAddr
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.conn = conn
+
+	log.Debugf("Starting UDP proxy on '%s' with %d upstreams", server.ListenAddress.GetAddress(), len(server.Data.Upstreams))
+	go server.serve()
+}
+
+// Read datagrams until the connection gets closed
+func (server *UDPServer) serve() {
+	listener := server.ListenAddress.GetAddress()
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, client, err := server.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			log.Error("UDP read: ", err)
+			continue
+		}
+
+		if !server.Data.IsAllowed(client.IP) {
+			log.Debugf("IP %s is not allowed", client.IP)
+			metrics.get(counterMetric, "reverseproxy_udp_denied_datagrams_total", "UDP datagrams denied by the allow list", "listener", listener).add(1)
+			continue
+		}
+
+		session := server.getSession(client)
+		if session == nil {
+			continue
+		}
+
+		atomic.StoreInt64(&session.lastActivity, time.Now().UnixNano())
+		if _, err := session.conn.Write(buf[:n]); err != nil {
+			log.Debugf("Can't send datagram to upstream '%s': %s", session.upstream.address, err)
+			continue
+		}
+
+		metrics.get(counterMetric, "reverseproxy_udp_received_bytes_total", "Bytes received from UDP clients", "listener", listener, "upstream", session.upstream.address).add(int64(n))
+	}
+}
+
+// Return the session of client. Creates a new one if it doesn't exist
+func (server *UDPServer) getSession(client *net.UDPAddr) *udpSession {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if session, ok := server.sessions[client.String()]; ok {
+		return session
+	}
+
+	if len(server.sessions) >= server.Data.GetMaxSessions() {
+		server.evict()
+	}
+
+	for _, upstream := range server.balancer.candidates(client.IP.String()) {
+		conn, err := net.DialUDP("udp", nil, server.addrs[upstream])
+		if err != nil {
+			log.Warnf("Can't connect to upstream '%s': %s", upstream.address, err)
+			continue
+		}
+
+		session := &udpSession{
+			client:       client,
+			upstream:     upstream,
+			conn:         conn,
+			lastActivity: time.Now().UnixNano(),
+		}
+		server.sessions[client.String()] = session
+
+		server.wg.Add(1)
+		go server.reply(session)
+		return session
+	}
+
+	log.Errorf("No upstream of '%s' is reachable", server.ListenAddress.GetAddress())
+	return nil
+}
+
+// Close the least recently active session to make room for a new one. The
+// mutex has to be held
+func (server *UDPServer) evict() {
+	var oldest *udpSession
+	for _, session := range server.sessions {
+		if oldest == nil || atomic.LoadInt64(&session.lastActivity) < atomic.LoadInt64(&oldest.lastActivity) {
+			oldest = session
+		}
+	}
+	if oldest == nil {
+		return
+	}
+
+	log.Debugf("Too many UDP sessions, closing the one of %s", oldest.client)
+	metrics.get(counterMetric, "reverseproxy_udp_evicted_sessions_total", "UDP sessions closed to stay below MaxSessions", "listener", server.ListenAddress.GetAddress()).add(1)
+
+	delete(server.sessions, oldest.client.String())
+	oldest.conn.Close()
+}
+
+// Send the replies of the upstream back to the client until the session was
+// idle for the idle timeout
+func (server *UDPServer) reply(session *udpSession) {
+	defer server.wg.Done()
+
+	labels := []string{"listener", server.ListenAddress.GetAddress(), "upstream", session.upstream.address}
+	sessions := metrics.get(gaugeMetric, "reverseproxy_udp_sessions", "Active UDP sessions", labels...)
+	sent := metrics.get(counterMetric, "reverseproxy_udp_sent_bytes_total", "Bytes sent to UDP clients", labels...)
+
+	atomic.AddInt64(&session.upstream.active, 1)
+	sessions.add(1)
+	defer func() {
+		// The client might have a new session already if this one was evicted
+		server.mutex.Lock()
+		if server.sessions[session.client.String()] == session {
+			delete(server.sessions, session.client.String())
+		}
+		server.mutex.Unlock()
+
+		session.conn.Close()
+		atomic.AddInt64(&session.upstream.active, -1)
+		sessions.add(-1)
+	}()
+
+	idleTimeout := server.Data.GetUDPIdleTimeout()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		session.conn.SetReadDeadline(time.Unix(0, atomic.LoadInt64(&session.lastActivity)).Add(idleTimeout))
+
+		n, err := session.conn.Read(buf)
+		if err != nil {
+			// Continue as long as the client sends datagrams
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && time.Since(time.Unix(0, atomic.LoadInt64(&session.lastActivity))) < idleTimeout {
+				continue
+			}
+
+			// Upstreams which aren't listening cause ICMP errors
+			if !errors.Is(err, net.ErrClosed) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+				log.Debugf("UDP upstream '%s': %s", session.upstream.address, err)
+			}
+			return
+		}
+
+		atomic.StoreInt64(&session.lastActivity, time.Now().UnixNano())
+		if _, err := server.conn.WriteToUDP(buf[:n], session.client); err != nil {
+			log.Debugf("Can't send datagram to client %s: %s", session.client, err)
+			continue
+		}
+		sent.add(int64(n))
+	}
+}
+
+// Shutdown stops reading datagrams and closes all sessions
+func (server *UDPServer) Shutdown(ctx context.Context) {
+	if server.conn != nil {
+		server.conn.Close()
+	}
+
+	server.mutex.Lock()
+	for _, session := range server.sessions {
+		session.conn.Close()
+	}
+	server.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		server.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
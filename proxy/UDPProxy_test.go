@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Answer each datagram with the address it was sent from. Returns the address
+func newUDPEchoUpstream(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			_, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP([]byte(addr.String()), addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// Start a udp task forwarding to the upstreams of data
+func startUDPProxy(t *testing.T, data models.StreamData) *UDPServer {
+	t.Helper()
+
+	server := NewUDPServer(&models.ListenAddress{
+		Address:  "127.0.0.1:0",
+		Task:     models.UDPTask,
+		TaskData: models.TaskData{Stream: &data},
+	})
+	server.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+
+	return server
+}
+
+// Create a client socket sending to server
+func dialUDPProxy(t *testing.T, server *UDPServer) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.DialUDP("udp", nil, server.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
+
+// Send a datagram and return the address the upstream received it from
+func udpRoundTrip(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 128)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+// Return the count of sessions of server
+func sessionCount(server *UDPServer) int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return len(server.sessions)
+}
+
+func TestUDPProxySessions(t *testing.T) {
+	server := startUDPProxy(t, models.StreamData{Upstreams: []string{newUDPEchoUpstream(t)}})
+	client1 := dialUDPProxy(t, server)
+	client2 := dialUDPProxy(t, server)
+
+	// Each client keeps its own connection to the upstream and gets its own replies
+	session1 := udpRoundTrip(t, client1)
+	session2 := udpRoundTrip(t, client2)
+	if session1 == session2 {
+		t.Fatalf("expected a session per client, both use %s", session1)
+	}
+	if session := udpRoundTrip(t, client1); session != session1 {
+		t.Fatalf("expected client 1 to keep using %s, got %s", session1, session)
+	}
+	if session := udpRoundTrip(t, client2); session != session2 {
+		t.Fatalf("expected client 2 to keep using %s, got %s", session2, session)
+	}
+	if n := sessionCount(server); n != 2 {
+		t.Fatalf("expected 2 sessions, got %d", n)
+	}
+}
+
+func TestUDPProxyIdleTimeout(t *testing.T) {
+	server := startUDPProxy(t, models.StreamData{
+		Upstreams:   []string{newUDPEchoUpstream(t)},
+		IdleTimeout: models.ConfigDuration(200 * time.Millisecond),
+	})
+	client := dialUDPProxy(t, server)
+
+	// Active sessions are kept
+	session := udpRoundTrip(t, client)
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if next := udpRoundTrip(t, client); next != session {
+			t.Fatalf("active session was closed, got %s instead of %s", next, session)
+		}
+	}
+
+	// Idle sessions expire
+	deadline := time.Now().Add(3 * time.Second)
+	for sessionCount(server) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle session wasn't closed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if next := udpRoundTrip(t, client); next == session {
+		t.Fatal("expected a new session after the idle timeout")
+	}
+}
+
+func TestUDPProxyMaxSessions(t *testing.T) {
+	server := startUDPProxy(t, models.StreamData{Upstreams: []string{newUDPEchoUpstream(t)}, MaxSessions: 1})
+	client1 := dialUDPProxy(t, server)
+	client2 := dialUDPProxy(t, server)
+
+	// The session of client 1 makes room for the one of client 2
+	session1 := udpRoundTrip(t, client1)
+	session2 := udpRoundTrip(t, client2)
+	if n := sessionCount(server); n != 1 {
+		t.Fatalf("expected 1 session, got %d", n)
+	}
+	server.mutex.Lock()
+	_, ok := server.sessions[client2.LocalAddr().String()]
+	server.mutex.Unlock()
+	if !ok {
+		t.Fatal("expected the session of client 2 to be kept")
+	}
+
+	// Client 1 gets a new session, evicting the one of client 2
+	if session := udpRoundTrip(t, client1); session == session1 {
+		t.Fatalf("expected a new session for client 1, got %s again", session)
+	}
+	if session := udpRoundTrip(t, client2); session == session2 {
+		t.Fatalf("expected a new session for client 2, got %s again", session)
+	}
+	if n := sessionCount(server); n != 1 {
+		t.Fatalf("expected 1 session, got %d", n)
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+)
+
+// Expand variables like $host or ${path} using the values of a request
+func expandVariables(s string, req *http.Request, location *models.RouteLocation) string {
+	return os.Expand(s, func(name string) string {
+		return requestVariable(name, req, location)
+	})
+}
+
+// Return the value of a variable for a request
+func requestVariable(name string, req *http.Request, location *models.RouteLocation) string {
+	// Use the URL requested by the client, req might be modified already
+	u := req.URL
+	if publicURL := getRequestContext(req).PublicURL; publicURL != nil {
+		u = publicURL
+	}
+
+	switch name {
+	case "$":
+		return "$"
+	case "scheme":
+		return requestScheme(req)
+	case "host":
+		return stripPort(req.Host)
+	case "http_host":
+		return req.Host
+	case "method":
+		return req.Method
+	case "path":
+		return u.Path
+	case "query":
+		return u.RawQuery
+	case "request_uri":
+		return u.RequestURI()
+	case "remote_addr":
+		return req.RemoteAddr
+	case "location_path":
+		if location != nil {
+			return location.RelativePath(u.Path)
+		}
+	case "client_ip":
+		return clientIP(req, location)
+	case "request_id":
+		return getRequestContext(req).RequestID
+	case "server_name":
+		return serverName(req, location)
+	case "tls_version":
+		if req.TLS != nil {
+			return strings.Replace(tls.VersionName(req.TLS.Version), "TLS ", "TLSv", 1)
+		}
+	case "msec":
+		start := getRequestContext(req).StartTime
+		if start.IsZero() {
+			start = time.Now()
+		}
+		return fmt.Sprintf("%d.%03d", start.Unix(), start.Nanosecond()/int(time.Millisecond))
+	case "time_iso8601":
+		return time.Now().Format(time.RFC3339)
+	default:
+		// Regex captures of the location
+		if index, err := strconv.Atoi(name); err == nil && index > 0 && location != nil {
+			captures := location.Captures(u.Path)
+			if index <= len(captures) {
+				return captures[index-1]
+			}
+		}
+	}
+
+	return ""
+}
+
+// Return the IP of the client. Uses the SrcIPHeader of the location if set
+func clientIP(req *http.Request, location *models.RouteLocation) string {
+	if location != nil && len(location.SrcIPHeader) > 0 {
+		if ip := req.Header.Get(location.SrcIPHeader); len(ip) > 0 {
+			return strings.TrimSpace(strings.Split(ip, ",")[0])
+		}
+	}
+	return stripPort(req.RemoteAddr)
+}
+
+// Return the server name of the route matching the requested host
+func serverName(req *http.Request, location *models.RouteLocation) string {
+	host := strings.ToLower(stripPort(req.Host))
+	if location == nil || location.Route == nil || len(location.Route.ServerNames) == 0 {
+		return host
+	}
+
+	for _, name := range location.Route.ServerNames {
+		if name == host {
+			return name
+		}
+	}
+	return location.Route.ServerNames[0]
+}
+
+// Remove the port of a host
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// Return the scheme used by the client
+func requestScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,453 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JojiiOfficial/ReverseProxy/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebSocket opcodes
+const (
+	wsOpContinuation = 0x0
+	wsOpClose        = 0x8
+)
+
+// WebSocket close codes
+const (
+	wsCloseGoingAway     = 1001
+	wsCloseMessageTooBig = 1009
+)
+
+// Time the peers have to answer close frames sent by the proxy
+const wsCloseTimeout = time.Second
+
+var (
+	errWSFrameTooBig   = errors.New("frame too big")
+	errWSMessageTooBig = errors.New("message too big")
+)
+
+// Request headers which only apply to a single connection
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// Return true if a request asks for an upgrade to the WebSocket protocol
+func isWebSocketUpgrade(req *http.Request) bool {
+	return headerHasToken(req.Header, "Connection", "upgrade") && strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+// Return true if a comma separated header contains token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsPeer one side of a proxied WebSocket connection
+type wsPeer struct {
+	reader io.Reader
+	writer io.Writer
+	closer io.Closer
+	// Used to set deadlines. Not available for upstreams
+	conn net.Conn
+	// Frames sent to this peer have to be masked
+	mask bool
+
+	mutex sync.Mutex
+}
+
+// Send a close frame to the peer
+func (peer *wsPeer) writeClose(code int, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	frame := []byte{0x80 | wsOpClose, byte(len(payload))}
+	if peer.mask {
+		key := make([]byte, 4)
+		rand.Read(key)
+		frame[1] |= 0x80
+		frame = append(frame, key...)
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	frame = append(frame, payload...)
+
+	// Unblock writes of frames stuck at a slow peer
+	if peer.conn != nil {
+		peer.conn.SetWriteDeadline(time.Now().Add(wsCloseTimeout))
+	}
+
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	peer.writer.Write(frame)
+}
+
+// webSocketSession a proxied WebSocket connection
+type webSocketSession struct {
+	client   *wsPeer
+	upstream *wsPeer
+	config   models.WebSocketConfig
+
+	started      time.Time
+	lastActivity int64
+	closing      int32
+	closeOnce    sync.Once
+	done         chan struct{}
+}
+
+// Forward the frames of src to dst and enforce the size limits
+func (session *webSocketSession) pump(src, dst *wsPeer, bytes *metric) error {
+	maxFrame := int64(session.config.MaxFrameSize.Bytes())
+	maxMessage := int64(session.config.MaxMessageSize.Bytes())
+
+	header := make([]byte, 14)
+	var messageSize int64
+	for {
+		if _, err := io.ReadFull(src.reader, header[:2]); err != nil {
+			return err
+		}
+		atomic.StoreInt64(&session.lastActivity, time.Now().UnixNano())
+
+		opcode := header[0] & 0x0f
+		headerSize := 2
+		length := int64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			headerSize += 2
+		case 127:
+			headerSize += 8
+		}
+		if header[1]&0x80 != 0 {
+			headerSize += 4
+		}
+
+		if _, err := io.ReadFull(src.reader, header[2:headerSize]); err != nil {
+			return err
+		}
+		switch length {
+		case 126:
+			length = int64(binary.BigEndian.Uint16(header[2:4]))
+		case 127:
+			length = int64(binary.BigEndian.Uint64(header[2:10]) & (1<<63 - 1))
+		}
+
+		if maxFrame > 0 && length > maxFrame {
+			return errWSFrameTooBig
+		}
+
+		// Control frames can be sent between the frames of a message
+		if opcode < wsOpClose {
+			if opcode != wsOpContinuation {
+				messageSize = 0
+			}
+			messageSize += length
+			if maxMessage > 0 && messageSize > maxMessage {
+				return errWSMessageTooBig
+			}
+		}
+
+		// Don't forward anything after the proxy sent a close frame
+		if atomic.LoadInt32(&session.closing) == 1 {
+			if _, err := io.CopyN(io.Discard, src.reader, length); err != nil {
+				return err
+			}
+			if opcode == wsOpClose {
+				return nil
+			}
+			continue
+		}
+
+		dst.mutex.Lock()
+		_, err := dst.writer.Write(header[:headerSize])
+		if err == nil {
+			_, err = io.CopyN(dst.writer, src.reader, length)
+		}
+		dst.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+
+		bytes.add(int64(headerSize) + length)
+		atomic.StoreInt64(&session.lastActivity, time.Now().UnixNano())
+	}
+}
+
+// Send close frames to both peers and close the connections once they
+// answered or wsCloseTimeout passed
+func (session *webSocketSession) close(code int, reason string) {
+	if !atomic.CompareAndSwapInt32(&session.closing, 0, 1) {
+		return
+	}
+
+	time.AfterFunc(wsCloseTimeout, session.closeConns)
+	session.client.writeClose(code, reason)
+	session.upstream.writeClose(code, reason)
+}
+
+// Close the connections to both peers
+func (session *webSocketSession) closeConns() {
+	session.closeOnce.Do(func() {
+		session.client.closer.Close()
+		session.upstream.closer.Close()
+	})
+}
+
+// Close the session if it's idle or reached its max lifetime
+func (session *webSocketSession) watchdog() {
+	idleTimeout := session.config.GetIdleTimeout()
+	maxLifetime := time.Duration(session.config.MaxLifetime)
+
+	next := idleTimeout
+	if maxLifetime > 0 && maxLifetime < next {
+		next = maxLifetime
+	}
+
+	timer := time.NewTimer(next)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-session.done:
+			return
+		case <-timer.C:
+		}
+
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&session.lastActivity)))
+		if idle >= idleTimeout {
+			session.close(wsCloseGoingAway, "idle timeout")
+			return
+		}
+
+		next = idleTimeout - idle
+		if maxLifetime > 0 {
+			remaining := maxLifetime - time.Since(session.started)
+			if remaining <= 0 {
+				session.close(wsCloseGoingAway, "max lifetime reached")
+				return
+			}
+			if remaining < next {
+				next = remaining
+			}
+		}
+		timer.Reset(next)
+	}
+}
+
+// Forward frames in both directions until one of the peers disconnects
+func (session *webSocketSession) run(labels []string) {
+	received := metrics.get(counterMetric, "reverseproxy_websocket_received_bytes_total", "Bytes received from WebSocket clients", labels...)
+	sent := metrics.get(counterMetric, "reverseproxy_websocket_sent_bytes_total", "Bytes sent to WebSocket clients", labels...)
+
+	go session.watchdog()
+
+	errc := make(chan error, 2)
+	go func() {
+		errc <- session.pump(session.client, session.upstream, received)
+	}()
+	go func() {
+		errc <- session.pump(session.upstream, session.client, sent)
+	}()
+
+	for i := 0; i < 2; i++ {
+		err := <-errc
+		switch {
+		case err == errWSFrameTooBig || err == errWSMessageTooBig:
+			log.Debug("Closing WebSocket connection: ", err)
+			session.close(wsCloseMessageTooBig, err.Error())
+		case atomic.LoadInt32(&session.closing) == 0:
+			// One of the peers is gone
+			session.closeConns()
+		}
+	}
+
+	session.closeConns()
+	close(session.done)
+}
+
+// webSocketRegistry keeps track of the active WebSocket sessions of a server
+type webSocketRegistry struct {
+	mutex    sync.Mutex
+	sessions map[*webSocketSession]struct{}
+}
+
+func newWebSocketRegistry() *webSocketRegistry {
+	return &webSocketRegistry{sessions: make(map[*webSocketSession]struct{})}
+}
+
+func (registry *webSocketRegistry) add(session *webSocketSession) {
+	registry.mutex.Lock()
+	registry.sessions[session] = struct{}{}
+	registry.mutex.Unlock()
+}
+
+func (registry *webSocketRegistry) remove(session *webSocketSession) {
+	registry.mutex.Lock()
+	delete(registry.sessions, session)
+	registry.mutex.Unlock()
+}
+
+// Send close frames to all sessions and wait until they are closed
+func (registry *webSocketRegistry) closeAll(ctx context.Context) {
+	registry.mutex.Lock()
+	sessions := make([]*webSocketSession, 0, len(registry.sessions))
+	for session := range registry.sessions {
+		sessions = append(sessions, session)
+	}
+	registry.mutex.Unlock()
+
+	for _, session := range sessions {
+		go session.close(wsCloseGoingAway, "server shutting down")
+	}
+
+	for _, session := range sessions {
+		select {
+		case <-session.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Proxy a WebSocket connection
+func (httpServer *HTTPServer) webSocketTask(w http.ResponseWriter, req *http.Request, location *models.RouteLocation) {
+	config := models.WebSocketConfig{}
+	if location.WebSocket != nil {
+		config = *location.WebSocket
+	}
+
+	if config.Disable {
+		log.Debugf("WebSocket connections are disabled for location '%s'", location.Location)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if origin := req.Header.Get("Origin"); !config.AllowsOrigin(origin) {
+		log.Debugf("WebSocket origin '%s' is not allowed", origin)
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Build the upstream request
+	outreq := req.Clone(req.Context())
+	outreq.RequestURI = ""
+	outreq.Close = false
+	for _, name := range strings.Split(outreq.Header.Get("Connection"), ",") {
+		outreq.Header.Del(strings.TrimSpace(name))
+	}
+	for _, name := range hopHeaders {
+		outreq.Header.Del(name)
+	}
+	outreq.Header.Set("Connection", "Upgrade")
+	outreq.Header.Set("Upgrade", req.Header.Get("Upgrade"))
+	if prior := req.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+		outreq.Header.Set("X-Forwarded-For", strings.Join(prior, ", ")+", "+stripPort(req.RemoteAddr))
+	} else {
+		outreq.Header.Set("X-Forwarded-For", stripPort(req.RemoteAddr))
+	}
+
+	location.ModifyProxyRequest(outreq)
+	modifyRequestHeader(outreq, location)
+	switch outreq.URL.Scheme {
+	case "ws":
+		outreq.URL.Scheme = "http"
+	case "wss":
+		outreq.URL.Scheme = "https"
+	}
+	log.Debug("WebSocket destination: -> ", outreq.URL)
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if len(location.UnixSocket) > 0 {
+		transport = unixTransport(location.UnixSocket)
+	} else if location.SendProxyProtocol > 0 {
+		outreq, transport = withProxyProtocol(outreq, location.SendProxyProtocol)
+	}
+	resp, err := transport.RoundTrip(outreq)
+	if err != nil {
+		log.Debug("WebSocket upstream error: ", err)
+		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	// Pass refused upgrades to the client
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	upstreamConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok || !strings.EqualFold(resp.Header.Get("Upgrade"), req.Header.Get("Upgrade")) {
+		resp.Body.Close()
+		log.Debug("Invalid WebSocket upgrade response of upstream")
+		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer upstreamConn.Close()
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Error("Can't hijack WebSocket connection: ", err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	// Long living connections use their own timeouts instead of the ones of the server
+	conn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(brw, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		return
+	}
+
+	session := &webSocketSession{
+		client:       &wsPeer{reader: brw.Reader, writer: conn, closer: conn, conn: conn},
+		upstream:     &wsPeer{reader: upstreamConn, writer: upstreamConn, closer: upstreamConn, mask: true},
+		config:       config,
+		started:      time.Now(),
+		lastActivity: time.Now().UnixNano(),
+		done:         make(chan struct{}),
+	}
+
+	labels := locationLabels(location)
+	connections := metrics.get(gaugeMetric, "reverseproxy_websocket_connections", "Active WebSocket connections", labels...)
+	connections.add(1)
+	defer connections.add(-1)
+
+	httpServer.webSockets.add(session)
+	defer httpServer.webSockets.remove(session)
+
+	session.run(labels)
+}
+
+// Return the metric labels of a location
+func locationLabels(location *models.RouteLocation) []string {
+	route := ""
+	if location.Route != nil {
+		route = location.Route.FileName
+	}
+	return []string{"route", route, "location", location.Location}
+}